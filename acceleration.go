@@ -0,0 +1,165 @@
+/*
+ *    Copyright (c) 2018-2019, 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	accelerationFlat     string = "flat"
+	accelerationAdaptive string = "adaptive"
+	accelerationCustom   string = "custom"
+)
+
+const maxAccelerationPoints int = 64
+
+var accelerationProfiles = []string{accelerationFlat, accelerationAdaptive}
+
+// Points of the predefined profiles. The adaptive profile slows down slow
+// movements for precision and speeds up fast movements, like the adaptive
+// profile of libinput.
+var accelerationProfilePoints = map[string][]accelerationPoint{
+	accelerationFlat:     {{0, 1}},
+	accelerationAdaptive: {{0, 0}, {87, 1}, {173, 1}, {553, 2}},
+}
+
+// accelerationPoint is the multiplier for movements with the speed in pixels
+// per second.
+type accelerationPoint [2]float64
+
+// accelerationProfile maps the speed of pointer movements to a multiplier.
+// Clients interpolate linearly between the points and use the multiplier of
+// the outermost points for slower and faster movements. The points of the
+// predefined profiles are sent too, so that clients don't need to know them.
+type accelerationProfile struct {
+	Profile string              `json:"profile"`
+	Points  []accelerationPoint `json:"points"`
+}
+
+var defaultAcceleration = accelerationProfile{
+	Profile: accelerationAdaptive, Points: accelerationProfilePoints[accelerationAdaptive],
+}
+
+// parseAcceleration parses the name of a predefined profile or a list of
+// points as SPEED:FACTOR[,SPEED:FACTOR...].
+func parseAcceleration(value string) (accelerationProfile, error) {
+	if points, ok := accelerationProfilePoints[value]; ok {
+		return accelerationProfile{Profile: value, Points: points}, nil
+	}
+	var points []accelerationPoint
+	for _, pointValue := range strings.Split(value, ",") {
+		speedValue, factorValue, found := strings.Cut(pointValue, ":")
+		if !found {
+			return accelerationProfile{}, fmt.Errorf("invalid profile %#v", value)
+		}
+		speed, err := strconv.ParseFloat(strings.TrimSpace(speedValue), 64)
+		if err != nil {
+			return accelerationProfile{}, fmt.Errorf("invalid speed %#v", speedValue)
+		}
+		factor, err := strconv.ParseFloat(strings.TrimSpace(factorValue), 64)
+		if err != nil {
+			return accelerationProfile{}, fmt.Errorf("invalid factor %#v", factorValue)
+		}
+		points = append(points, accelerationPoint{speed, factor})
+	}
+	p := accelerationProfile{Profile: accelerationCustom, Points: points}
+	return p, p.validate()
+}
+
+func (p accelerationProfile) validate() error {
+	if _, ok := accelerationProfilePoints[p.Profile]; !ok && p.Profile != accelerationCustom {
+		return fmt.Errorf("invalid profile %#v", p.Profile)
+	}
+	if len(p.Points) == 0 {
+		return errors.New("points missing")
+	}
+	if len(p.Points) > maxAccelerationPoints {
+		return fmt.Errorf("more than %d points", maxAccelerationPoints)
+	}
+	for i, point := range p.Points {
+		speed, factor := point[0], point[1]
+		if math.IsNaN(speed) || math.IsInf(speed, 0) || math.IsNaN(factor) || math.IsInf(factor, 0) {
+			return errors.New("points must be finite")
+		}
+		if speed < 0 || factor < 0 {
+			return errors.New("points must not be negative")
+		}
+		if i > 0 && speed <= p.Points[i-1][0] {
+			return errors.New("speeds must be increasing")
+		}
+	}
+	return nil
+}
+
+// String and Set implement flag.Value.
+func (p *accelerationProfile) String() string {
+	if p.Profile != accelerationCustom {
+		return p.Profile
+	}
+	pointValues := make([]string, len(p.Points))
+	for i, point := range p.Points {
+		pointValues[i] = strconv.FormatFloat(point[0], 'g', -1, 64) + ":" +
+			strconv.FormatFloat(point[1], 'g', -1, 64)
+	}
+	return strings.Join(pointValues, ",")
+}
+
+func (p *accelerationProfile) Set(value string) error {
+	parsed, err := parseAcceleration(value)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// UnmarshalJSON accepts the value of the option as string or the object that
+// is sent to clients. The points of predefined profiles can't be changed.
+func (p *accelerationProfile) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		return p.Set(value)
+	}
+	var object struct {
+		Profile string              `json:"profile"`
+		Points  []accelerationPoint `json:"points"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	parsed := accelerationProfile{Profile: object.Profile, Points: object.Points}
+	if points, ok := accelerationProfilePoints[object.Profile]; ok {
+		if object.Points != nil {
+			return fmt.Errorf("points of profile %#v can't be changed", object.Profile)
+		}
+		parsed.Points = points
+	}
+	if err := parsed.validate(); err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
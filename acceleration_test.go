@@ -0,0 +1,83 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseAcceleration(t *testing.T) {
+	for value, expected := range map[string]string{
+		"flat":               "flat [[0 1]]",
+		"adaptive":           "adaptive [[0 0] [87 1] [173 1] [553 2]]",
+		"0:0.5, 100:1,500:3": "custom [[0 0.5] [100 1] [500 3]]",
+	} {
+		p, err := parseAcceleration(value)
+		if err != nil {
+			t.Errorf("%s: %v", value, err)
+		} else if actual := fmt.Sprint(p.Profile, " ", p.Points); actual != expected {
+			t.Errorf("%s: unexpected profile: %s", value, actual)
+		}
+	}
+	p, _ := parseAcceleration("0:0.5,100:1")
+	if p.String() != "0:0.5,100:1" {
+		t.Errorf("unexpected string: %s", p.String())
+	}
+}
+
+func TestParseAccelerationErrors(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":               "invalid profile",
+		"linear":         "invalid profile",
+		"0:1,x:2":        "invalid speed",
+		"0:1,1:Inf":      "finite",
+		"0:-1":           "negative",
+		"0:1,100:2,50:3": "increasing",
+	} {
+		if _, err := parseAcceleration(value); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: unexpected error: %v", value, err)
+		}
+	}
+}
+
+func TestUnmarshalAcceleration(t *testing.T) {
+	for data, expected := range map[string]string{
+		`"flat"`:              "flat [[0 1]]",
+		`{"profile": "flat"}`: "flat [[0 1]]",
+		`{"profile": "custom", "points": [[0, 2]]}`:   "custom [[0 2]]",
+		`{"profile": "flat", "points": [[0, 2]]}`:     "can't be changed",
+		`{"profile": "custom", "points": []}`:         "points missing",
+		`{"profile": "custom", "points": [[1], [0]]}`: "increasing",
+	} {
+		var p accelerationProfile
+		var actual string
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			actual = err.Error()
+		} else {
+			actual = fmt.Sprint(p.Profile, " ", p.Points)
+		}
+		if !strings.Contains(actual, expected) {
+			t.Errorf("%s: unexpected result: %s", data, actual)
+		}
+	}
+}
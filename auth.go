@@ -0,0 +1,222 @@
+/*
+ *    Copyright (c) 2018-2019, 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/unrud/remote-touchpad/inputcontrol"
+)
+
+// Scopes restrict the input that clients can send:
+//   - pointer: pointer movement, scrolling and buttons
+//   - text: text input
+//   - keys: all keys
+//   - media: volume and media keys
+//   - navigation: arrow, home, end and browser navigation keys
+//   - settings: changes of the own config
+//   - pairing: pairing of new devices, that keep the scopes
+const (
+	scopePointer    string = "pointer"
+	scopeText       string = "text"
+	scopeKeys       string = "keys"
+	scopeMedia      string = "media"
+	scopeNavigation string = "navigation"
+	scopeSettings   string = "settings"
+	scopePairing    string = "pairing"
+	scopeAll        string = "all"
+)
+
+var allScopes = []string{
+	scopePointer, scopeText, scopeKeys, scopeMedia, scopeNavigation, scopeSettings, scopePairing,
+}
+
+var scopeKeyGroups = map[string][]inputcontrol.Key{
+	scopeMedia: {
+		inputcontrol.KeyVolumeMute, inputcontrol.KeyVolumeDown, inputcontrol.KeyVolumeUp,
+		inputcontrol.KeyMediaPlayPause, inputcontrol.KeyMediaPrevTrack,
+		inputcontrol.KeyMediaNextTrack,
+	},
+	scopeNavigation: {
+		inputcontrol.KeyLeft, inputcontrol.KeyRight, inputcontrol.KeyUp, inputcontrol.KeyDown,
+		inputcontrol.KeyHome, inputcontrol.KeyEnd,
+		inputcontrol.KeyBrowserBack, inputcontrol.KeyBrowserForward,
+	},
+}
+
+// parseScopes parses a comma-separated list of scopes. The result is in the
+// order of allScopes.
+func parseScopes(value string) ([]string, error) {
+	var selected []string
+	for _, scope := range strings.Split(value, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == scopeAll {
+			selected = append(selected, allScopes...)
+		} else if slices.Contains(allScopes, scope) {
+			selected = append(selected, scope)
+		} else {
+			return nil, fmt.Errorf("invalid scope: %#v", scope)
+		}
+	}
+	var scopes []string
+	for _, scope := range allScopes {
+		if slices.Contains(selected, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+type credential struct {
+	secret string
+	scopes []string
+	// ID of the paired device or empty
+	device string
+	// Name of the user or empty. Devices keep the user that paired them.
+	user string
+}
+
+// allows checks if the command is permitted by the scopes of the credential.
+func (c *credential) allows(cmd command) bool {
+	switch cmd.Type {
+	case messageMove, messageScroll, messageButton:
+		return slices.Contains(c.scopes, scopePointer)
+	case messageText:
+		return slices.Contains(c.scopes, scopeText)
+	case messageSettings:
+		return slices.Contains(c.scopes, scopeSettings)
+	case messagePair:
+		return slices.Contains(c.scopes, scopePairing)
+	case messageKey:
+		if slices.Contains(c.scopes, scopeKeys) {
+			return true
+		}
+		for scope, keys := range scopeKeyGroups {
+			if slices.Contains(c.scopes, scope) &&
+				slices.Contains(keys, inputcontrol.Key(cmd.Key)) {
+				return true
+			}
+		}
+		return false
+	case messageBatch:
+		for _, subCmd := range cmd.Commands {
+			if !c.allows(subCmd) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// Authentication schemes:
+//
+//  1. The response is the HMAC-SHA256 of the secret keyed by the challenge.
+//     Used by legacy clients.
+//  2. The response is the HMAC-SHA256 of the challenge keyed by the secret.
+//     Clients that request encryption append ":encryption" to the challenge,
+//     so that the request can't be removed from the hello.
+//  3. The client proves knowledge of the PIN shown in the terminal with a
+//     password-authenticated key exchange.
+//  4. The client authenticates with its TLS client certificate and sends no
+//     response.
+//
+// The response isn't verified for clients with a valid client certificate,
+// unless the PIN is used.
+const (
+	authSchemeLegacy      int = 1
+	authScheme            int = 2
+	authSchemePIN         int = 3
+	authSchemeCertificate int = 4
+)
+
+var (
+	errChallengeUsed     = errors.New("challenge already used")
+	errChallengeExpired  = errors.New("challenge expired")
+	errUnsupportedScheme = errors.New("unsupported authentication scheme")
+	errAuthentication    = errors.New("authentication failed")
+)
+
+// challenge is sent to every new connection. It can only be answered once and
+// only until it expires.
+type challenge struct {
+	message string
+	expiry  time.Time
+	used    bool
+}
+
+func (c *challenge) expectedResponse(scheme int, secret string, encryption bool) string {
+	var mac hash.Hash
+	if scheme == authSchemeLegacy {
+		mac = hmac.New(sha256.New, []byte(c.message))
+		mac.Write([]byte(secret))
+	} else {
+		mac = hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(c.message))
+		if encryption {
+			mac.Write([]byte(":" + featureEncryption))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// use marks the challenge as answered.
+func (c *challenge) use() error {
+	if c.used {
+		return errChallengeUsed
+	}
+	c.used = true
+	if !c.expiry.IsZero() && time.Now().After(c.expiry) {
+		return errChallengeExpired
+	}
+	return nil
+}
+
+// authenticate returns the credential that matches the response. Encryption
+// reports whether the client requested encryption.
+func (c *challenge) authenticate(credentials []*credential, scheme int, response string, encryption bool) (*credential, error) {
+	if err := c.use(); err != nil {
+		return nil, err
+	}
+	if scheme != authSchemeLegacy && scheme != authScheme {
+		return nil, errUnsupportedScheme
+	}
+	for _, cred := range credentials {
+		if hmac.Equal([]byte(c.expectedResponse(scheme, cred.secret, encryption)), []byte(response)) {
+			return cred, nil
+		}
+	}
+	return nil, errAuthentication
+}
+
+func newChallenge(timeout time.Duration) *challenge {
+	return &challenge{
+		message: secureRandBase64(challengeLength),
+		expiry:  time.Now().Add(timeout),
+	}
+}
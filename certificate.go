@@ -0,0 +1,135 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const selfSignedValidity time.Duration = 5 * 365 * 24 * time.Hour
+
+// Prefix of the certificate fingerprint in the URL fragment
+const fingerprintPrefix string = "~sha256:"
+
+func defaultSelfSignedPaths() (string, string) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", ""
+	}
+	dir := filepath.Join(configDir, "remote-touchpad")
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+// loadSelfSignedCertificate loads the certificate from the files or generates
+// a new one, if the files are missing, the certificate expired or doesn't
+// cover the host.
+func loadSelfSignedCertificate(certFile, keyFile, host string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil {
+		now := time.Now()
+		if now.After(cert.Leaf.NotBefore) && now.Before(cert.Leaf.NotAfter) &&
+			cert.Leaf.VerifyHostname(host) == nil {
+			return cert, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return tls.Certificate{}, err
+	}
+	certPEM, keyPEM, err := generateSelfSignedCertificate(host)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	for _, file := range []struct {
+		path string
+		data []byte
+	}{{keyFile, keyPEM}, {certFile, certPEM}} {
+		if err := os.MkdirAll(filepath.Dir(file.path), 0o700); err != nil {
+			return tls.Certificate{}, err
+		}
+		if err := os.WriteFile(file.path, file.data, 0o600); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func generateSelfSignedCertificate(host string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: prettyAppName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// certificateFingerprint returns the SHA-256 fingerprint of the certificate
+// in the URL-safe base64 encoding and in the hexadecimal notation of browsers.
+func certificateFingerprint(cert tls.Certificate) (string, string) {
+	sum := sha256.Sum256(cert.Certificate[0])
+	hexParts := make([]string, len(sum))
+	for i, b := range sum {
+		hexParts[i] = fmt.Sprintf("%02X", b)
+	}
+	return base64.RawURLEncoding.EncodeToString(sum[:]), strings.Join(hexParts, ":")
+}
@@ -0,0 +1,55 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	cert, err := loadSelfSignedCertificate(certFile, keyFile, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Leaf.VerifyHostname("192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, _ := certificateFingerprint(cert)
+	cert, err = loadSelfSignedCertificate(certFile, keyFile, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, _ := certificateFingerprint(cert); reloaded != fingerprint {
+		t.Fatal("certificate was not persisted")
+	}
+	cert, err = loadSelfSignedCertificate(certFile, keyFile, "example.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regenerated, _ := certificateFingerprint(cert); regenerated == fingerprint {
+		t.Fatal("certificate was not regenerated for new host")
+	}
+	if err := cert.Leaf.VerifyHostname("example.local"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+)
+
+// Subject of client certificates that matches every certificate
+const anySubject string = "*"
+
+var errNoClientCertificate = errors.New("no valid client certificate")
+
+// clientCertificate grants the credential to clients with a verified
+// certificate. The subject is compared with the common name and with the
+// complete subject of the certificate.
+type clientCertificate struct {
+	subject    string
+	credential *credential
+}
+
+func (c *clientCertificate) matches(cert *x509.Certificate) bool {
+	return c.subject == anySubject || c.subject == cert.Subject.CommonName ||
+		c.subject == cert.Subject.String()
+}
+
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates found")
+	}
+	return pool, nil
+}
+
+// certificateCredential returns the credential for the verified client
+// certificate of the connection and the subject of the certificate. The
+// credential is nil without a matching certificate.
+func certificateCredential(state *tls.ConnectionState, clientCertificates []clientCertificate) (*credential, string) {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return nil, ""
+	}
+	cert := state.VerifiedChains[0][0]
+	for _, clientCert := range clientCertificates {
+		if clientCert.matches(cert) {
+			return clientCert.credential, cert.Subject.String()
+		}
+	}
+	return nil, cert.Subject.String()
+}
@@ -0,0 +1,178 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// testCA issues client certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, subject pkix.Name) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func startTLSTestServer(t *testing.T, ca *testCA, options ...func(*server)) (*server, string) {
+	t.Helper()
+	s, _ := newTestServer(options...)
+	httpServer := httptest.NewUnstartedServer(websocket.Handler(s.handleWebSocket))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	httpServer.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	httpServer.StartTLS()
+	t.Cleanup(httpServer.Close)
+	return s, "wss" + strings.TrimPrefix(httpServer.URL, "https")
+}
+
+func dialTLSTestServer(t *testing.T, url string, certificates ...tls.Certificate) *websocket.Conn {
+	t.Helper()
+	config, err := websocket.NewConfig(url, "https://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.TlsConfig = &tls.Config{InsecureSkipVerify: true, Certificates: certificates}
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+func TestClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	_, url := startTLSTestServer(t, ca, func(s *server) {
+		s.clientCertificates = []clientCertificate{
+			{subject: "phone", credential: &credential{scopes: []string{scopeMedia}}},
+			{subject: "CN=tablet,O=Example", credential: &credential{scopes: allScopes}},
+		}
+	})
+	for _, test := range []struct {
+		subject pkix.Name
+		scopes  string
+	}{
+		{pkix.Name{CommonName: "phone", Organization: []string{"Example"}}, "[media]"},
+		{pkix.Name{CommonName: "tablet", Organization: []string{"Example"}}, fmt.Sprint(allScopes)},
+	} {
+		ws := dialTLSTestServer(t, url, ca.issue(t, test.subject))
+		sendHelloWithSecret(t, ws, "", map[string]any{"auth": authSchemeCertificate, "versions": []int{2},
+			"features": []string{featureEncryption}})
+		hello := receiveJSON(t, ws)
+		if hello["type"] != messageHello || fmt.Sprint(hello["scopes"]) != test.scopes ||
+			fmt.Sprint(hello["features"]) != "[]" {
+			t.Fatalf("%v: unexpected hello: %#v", test.subject, hello)
+		}
+	}
+}
+
+func TestClientCertificateSkipsChallenge(t *testing.T) {
+	ca := newTestCA(t)
+	_, url := startTLSTestServer(t, ca, func(s *server) {
+		s.clientCertificates = []clientCertificate{{subject: anySubject, credential: &credential{scopes: allScopes}}}
+	})
+	ws := dialTLSTestServer(t, url, ca.issue(t, pkix.Name{CommonName: "phone"}))
+	sendHelloWithSecret(t, ws, "wrong", map[string]any{"versions": []int{2}})
+	if hello := receiveJSON(t, ws); hello["type"] != messageHello {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+}
+
+func TestClientCertificateRejected(t *testing.T) {
+	ca := newTestCA(t)
+	_, url := startTLSTestServer(t, ca, func(s *server) {
+		s.clientCertificates = []clientCertificate{{subject: "phone", credential: &credential{scopes: allScopes}}}
+	})
+	for _, ws := range []*websocket.Conn{
+		dialTLSTestServer(t, url, ca.issue(t, pkix.Name{CommonName: "laptop"})),
+		dialTLSTestServer(t, url),
+	} {
+		sendHelloWithSecret(t, ws, "", map[string]any{"auth": authSchemeCertificate, "versions": []int{2}})
+		if message := receiveJSON(t, ws); message["code"] != errorUnauthorized {
+			t.Fatalf("unexpected message: %#v", message)
+		}
+	}
+	// The secret can still be used
+	ws := dialTLSTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}})
+	if hello := receiveJSON(t, ws); hello["type"] != messageHello {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// Flags that can't be set in the configuration file
+var commandLineOnlyFlags = []string{"config", "version", "list-devices", "revoke-device"}
+
+// Flags that replace each other. The configuration file can't set one of them,
+// when the other is set on the command line.
+var alternativeFlags = map[string]string{"secret": "secret-file", "secret-file": "secret"}
+
+func defaultConfigFilePath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "remote-touchpad", "config.json")
+}
+
+// loadConfigFile sets the flags from the JSON object in the file. The keys are
+// the names of the flags. Flags that are set on the command line take
+// precedence. A missing file is only an error when it was requested
+// explicitly.
+func loadConfigFile(flags *flag.FlagSet, path string, explicit bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	commandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { commandLine[f.Name] = true })
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f := flags.Lookup(key)
+		if f == nil || slices.Contains(commandLineOnlyFlags, key) {
+			return fmt.Errorf("%s: unknown key %#v", path, key)
+		}
+		if commandLine[key] || commandLine[alternativeFlags[key]] {
+			continue
+		}
+		if err := setFlagFromJSON(flags, key, values[key]); err != nil {
+			return fmt.Errorf("%s: key %#v: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+func setFlagFromJSON(flags *flag.FlagSet, name string, value any) error {
+	switch value := value.(type) {
+	case string, json.Number, bool:
+		return flags.Set(name, fmt.Sprint(value))
+	case []any:
+		for _, element := range value {
+			if _, ok := element.([]any); ok {
+				return errors.New("nested lists are not supported")
+			}
+			if err := setFlagFromJSON(flags, name, element); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		// Objects are passed to the flag as JSON
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		return flags.Set(name, string(data))
+	}
+	return fmt.Errorf("unsupported value: %v", value)
+}
@@ -0,0 +1,116 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	bind := flags.String("bind", ":0", "")
+	moveSpeed := flags.Float64("move-speed", 1, "")
+	pingInterval := flags.Duration("ping-interval", time.Second, "")
+	legacyAuth := flags.Bool("legacy-auth", true, "")
+	var guests []string
+	flags.Func("guest", "", func(value string) error {
+		guests = append(guests, value)
+		return nil
+	})
+	var users []string
+	flags.Func("user", "", func(value string) error {
+		users = append(users, value)
+		return nil
+	})
+	if err := flags.Parse([]string{"-bind", ":8080"}); err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfigFile(t, `{"bind": ":9090", "move-speed": 1.5, "ping-interval": "5s",
+		"legacy-auth": false, "guest": ["media", "pointer:secret"], "user": [{"name": "alice", "move-speed": 2}]}`)
+	if err := loadConfigFile(flags, path, true); err != nil {
+		t.Fatal(err)
+	}
+	if *bind != ":8080" || *moveSpeed != 1.5 || *pingInterval != 5*time.Second || *legacyAuth ||
+		strings.Join(guests, " ") != "media pointer:secret" ||
+		strings.Join(users, " ") != `{"move-speed":2,"name":"alice"}` {
+		t.Fatalf("unexpected values: %v %v %v %v %v %v", *bind, *moveSpeed, *pingInterval, *legacyAuth, guests, users)
+	}
+}
+
+func TestLoadConfigFileAlternatives(t *testing.T) {
+	for _, arguments := range [][]string{{"-secret-file", "secret.txt"}, {"-secret", "secret"}} {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		secret := flags.String("secret", "", "")
+		secretFile := flags.String("secret-file", "", "")
+		if err := flags.Parse(arguments); err != nil {
+			t.Fatal(err)
+		}
+		path := writeConfigFile(t, `{"secret": "from-file", "secret-file": "from-file.txt"}`)
+		if err := loadConfigFile(flags, path, true); err != nil {
+			t.Fatal(err)
+		}
+		if (*secret == "") == (*secretFile == "") || strings.HasPrefix(*secret+*secretFile, "from-file") {
+			t.Fatalf("unexpected values: %v %v", *secret, *secretFile)
+		}
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	for content, expected := range map[string]string{
+		`{"unknown": 1}`:           `unknown key "unknown"`,
+		`{"version": true}`:        `unknown key "version"`,
+		`{"move-speed": "fast"}`:   `key "move-speed"`,
+		`{"move-speed": {"a": 1}}`: `key "move-speed"`,
+		`[]`:                       "cannot unmarshal",
+	} {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.Float64("move-speed", 1, "")
+		flags.Bool("version", false, "")
+		path := writeConfigFile(t, content)
+		if err := loadConfigFile(flags, path, true); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: unexpected error: %v", content, err)
+		}
+	}
+}
+
+func TestLoadMissingConfigFile(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := loadConfigFile(flags, path, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfigFile(flags, path, true); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,262 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	deviceIDLength    int = 8
+	deviceTokenLength int = 32
+	maxDeviceName     int = 100
+	// Every pairing rewrites the file
+	maxDevices int = 100
+)
+
+var (
+	errUnknownDevice  = errors.New("unknown device")
+	errTooManyDevices = fmt.Errorf("maximum of %d paired devices reached", maxDevices)
+)
+
+// device is a paired client that authenticates with its own token instead of
+// the secret.
+type device struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+	User   string   `json:"user,omitempty"`
+	// Config changed by the device
+	Settings map[string]json.RawMessage `json:"settings,omitempty"`
+	Paired   time.Time                  `json:"paired"`
+	LastSeen time.Time                  `json:"lastSeen,omitzero"`
+}
+
+// deviceStore keeps the paired devices in a JSON file. The file is read for
+// every lookup, so that devices revoked by another process are rejected.
+type deviceStore struct {
+	mutex       sync.Mutex
+	path        string
+	credentials map[string]*credential
+}
+
+func newDeviceStore(path string) *deviceStore {
+	return &deviceStore{path: path, credentials: make(map[string]*credential)}
+}
+
+func defaultDeviceStorePath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "remote-touchpad", "devices.json")
+}
+
+func (s *deviceStore) loadLocked() ([]device, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var devices []device
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return devices, nil
+}
+
+func (s *deviceStore) saveLocked(devices []device) error {
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".devices-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// pair adds a new device with the scopes and the user of the credential that
+// paired it.
+func (s *deviceStore) pair(name string, cred *credential) (device, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	devices, err := s.loadLocked()
+	if err != nil {
+		return device{}, err
+	}
+	if len(devices) >= maxDevices {
+		return device{}, errTooManyDevices
+	}
+	id := make([]byte, deviceIDLength)
+	if _, err := rand.Read(id); err != nil {
+		return device{}, err
+	}
+	d := device{
+		ID:     hex.EncodeToString(id),
+		Name:   name,
+		Token:  secureRandBase64(deviceTokenLength),
+		Scopes: cred.scopes,
+		User:   cred.user,
+		Paired: time.Now().UTC().Truncate(time.Second),
+	}
+	if err := s.saveLocked(append(devices, d)); err != nil {
+		return device{}, err
+	}
+	return d, nil
+}
+
+// credential returns the credential of the device. The same credential is
+// returned as long as the device is unchanged, so that sessions can be resumed.
+func (s *deviceStore) credential(id string) (*credential, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	devices, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(devices, func(d device) bool { return d.ID == id })
+	if i < 0 {
+		delete(s.credentials, id)
+		return nil, errUnknownDevice
+	}
+	d := devices[i]
+	cred := s.credentials[id]
+	if cred == nil || cred.secret != d.Token || !slices.Equal(cred.scopes, d.Scopes) || cred.user != d.User {
+		cred = &credential{secret: d.Token, scopes: d.Scopes, device: d.ID, user: d.User}
+		s.credentials[id] = cred
+	}
+	return cred, nil
+}
+
+// seen updates the time when the device was last seen.
+func (s *deviceStore) seen(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	devices, err := s.loadLocked()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(devices, func(d device) bool { return d.ID == id })
+	if i < 0 {
+		return errUnknownDevice
+	}
+	devices[i].LastSeen = time.Now().UTC().Truncate(time.Second)
+	return s.saveLocked(devices)
+}
+
+// settings returns the config changed by the device.
+func (s *deviceStore) settings(id string) (map[string]json.RawMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	devices, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(devices, func(d device) bool { return d.ID == id })
+	if i < 0 {
+		return nil, errUnknownDevice
+	}
+	return devices[i].Settings, nil
+}
+
+func (s *deviceStore) saveSettings(id string, settings map[string]json.RawMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	devices, err := s.loadLocked()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(devices, func(d device) bool { return d.ID == id })
+	if i < 0 {
+		return errUnknownDevice
+	}
+	devices[i].Settings = settings
+	return s.saveLocked(devices)
+}
+
+func (s *deviceStore) list() ([]device, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.loadLocked()
+}
+
+func printDevices(s *deviceStore) error {
+	devices, err := s.list()
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		fmt.Println("No paired devices")
+	}
+	for _, d := range devices {
+		lastSeen := "never"
+		if !d.LastSeen.IsZero() {
+			lastSeen = d.LastSeen.Local().Format(time.DateTime)
+		}
+		user := ""
+		if d.User != "" {
+			user = ", user: " + d.User
+		}
+		fmt.Printf("%s  %s (%s)\n    paired: %s, last seen: %s%s\n", d.ID, d.Name,
+			strings.Join(d.Scopes, ", "), d.Paired.Local().Format(time.DateTime), lastSeen, user)
+	}
+	return nil
+}
+
+func (s *deviceStore) revoke(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	devices, err := s.loadLocked()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(devices, func(d device) bool { return d.ID == id })
+	if i < 0 {
+		return errUnknownDevice
+	}
+	delete(s.credentials, id)
+	return s.saveLocked(slices.Delete(devices, i, i+1))
+}
@@ -0,0 +1,116 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+)
+
+// Messages are encrypted with a keystream of HMAC-SHA256 blocks in counter
+// mode and authenticated with HMAC-SHA256 over the sequence number and the
+// ciphertext (encrypt-then-MAC). Only primitives that are available in the
+// web client without WebCrypto are used, because WebCrypto requires a secure
+// context. Sequence numbers aren't transmitted: WebSocket messages arrive in
+// order, so replayed, reordered or dropped messages fail authentication.
+const (
+	encryptionInfo string = "remote-touchpad encryption v1"
+	encryptionKey  int    = sha256.Size
+	encryptionTag  int    = sha256.Size
+)
+
+var errDecryption = errors.New("message authentication failed")
+
+type cipherState struct {
+	encryptionKey []byte
+	macKey        []byte
+	sequence      uint64
+}
+
+func (s *cipherState) keystreamXOR(dst, src []byte) {
+	block := make([]byte, 12)
+	binary.BigEndian.PutUint64(block, s.sequence)
+	for i := 0; i < len(src); i += sha256.Size {
+		binary.BigEndian.PutUint32(block[8:], uint32(i/sha256.Size))
+		mac := hmac.New(sha256.New, s.encryptionKey)
+		mac.Write(block)
+		keystream := mac.Sum(nil)
+		for j := i; j < len(src) && j-i < len(keystream); j++ {
+			dst[j] = src[j] ^ keystream[j-i]
+		}
+	}
+}
+
+func (s *cipherState) tag(ciphertext []byte) []byte {
+	mac := hmac.New(sha256.New, s.macKey)
+	binary.Write(mac, binary.BigEndian, s.sequence)
+	mac.Write(ciphertext)
+	return mac.Sum(nil)
+}
+
+// messageCipher encrypts the messages of a connection. The keys are derived
+// from the secret of the credential and the challenge of the connection. Both
+// directions use separate keys.
+type messageCipher struct {
+	send    cipherState
+	receive cipherState
+}
+
+func newMessageCipher(secret, challenge string, server bool) (*messageCipher, error) {
+	keys, err := hkdf.Key(sha256.New, []byte(secret), []byte(challenge), encryptionInfo, 4*encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	clientToServer := cipherState{encryptionKey: keys[0:encryptionKey], macKey: keys[encryptionKey : 2*encryptionKey]}
+	serverToClient := cipherState{encryptionKey: keys[2*encryptionKey : 3*encryptionKey], macKey: keys[3*encryptionKey:]}
+	if server {
+		return &messageCipher{send: serverToClient, receive: clientToServer}, nil
+	}
+	return &messageCipher{send: clientToServer, receive: serverToClient}, nil
+}
+
+// seal encrypts the next outgoing message. The result is base64 encoded.
+func (c *messageCipher) seal(plaintext []byte) string {
+	sealed := make([]byte, len(plaintext), len(plaintext)+encryptionTag)
+	c.send.keystreamXOR(sealed, plaintext)
+	sealed = append(sealed, c.send.tag(sealed)...)
+	c.send.sequence++
+	return base64.StdEncoding.EncodeToString(sealed)
+}
+
+// open decrypts the next incoming message.
+func (c *messageCipher) open(message string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(message)
+	if err != nil || len(sealed) < encryptionTag {
+		return nil, errDecryption
+	}
+	ciphertext, tag := sealed[:len(sealed)-encryptionTag], sealed[len(sealed)-encryptionTag:]
+	if !hmac.Equal(tag, c.receive.tag(ciphertext)) {
+		return nil, errDecryption
+	}
+	plaintext := make([]byte, len(ciphertext))
+	c.receive.keystreamXOR(plaintext, ciphertext)
+	c.receive.sequence++
+	return plaintext, nil
+}
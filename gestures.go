@@ -0,0 +1,124 @@
+/*
+ *    Copyright (c) 2018-2019, 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultTouchMoveThreshold = touchMoveThreshold{10, 15, 15}
+	defaultTouchTimeout       = milliseconds(250 * time.Millisecond)
+)
+
+// touchMoveThreshold is the distance in pixels that one, two and three
+// touches must move before they no longer count as tap.
+type touchMoveThreshold [3]float64
+
+func (t touchMoveThreshold) validate() error {
+	for _, distance := range t {
+		if math.IsNaN(distance) || math.IsInf(distance, 0) || distance < 0 {
+			return errors.New("must be finite and not negative")
+		}
+	}
+	return nil
+}
+
+// String and Set implement flag.Value. A single distance is used for all
+// numbers of touches.
+func (t *touchMoveThreshold) String() string {
+	values := make([]string, len(t))
+	for i, distance := range t {
+		values[i] = strconv.FormatFloat(distance, 'g', -1, 64)
+	}
+	return strings.Join(values, ",")
+}
+
+func (t *touchMoveThreshold) Set(value string) error {
+	values := strings.Split(value, ",")
+	if len(values) != 1 && len(values) != len(t) {
+		return fmt.Errorf("expected 1 or %d distances", len(t))
+	}
+	var parsed touchMoveThreshold
+	for i := range parsed {
+		distance, err := strconv.ParseFloat(strings.TrimSpace(values[i%len(values)]), 64)
+		if err != nil {
+			return fmt.Errorf("invalid distance %#v", values[i%len(values)])
+		}
+		parsed[i] = distance
+	}
+	if err := parsed.validate(); err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// UnmarshalJSON accepts the value of the option as string or the list that is
+// sent to clients.
+func (t *touchMoveThreshold) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		return t.Set(value)
+	}
+	var distances []float64
+	if err := json.Unmarshal(data, &distances); err != nil {
+		return err
+	}
+	if len(distances) != len(t) {
+		return fmt.Errorf("expected %d distances", len(t))
+	}
+	*t = touchMoveThreshold(distances)
+	return t.validate()
+}
+
+// milliseconds is a duration that is sent to clients as number of
+// milliseconds.
+type milliseconds time.Duration
+
+func (m milliseconds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(float64(m) / float64(time.Millisecond))
+}
+
+// UnmarshalJSON accepts the value of the option as string or the number that
+// is sent to clients.
+func (m *milliseconds) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*m = milliseconds(d)
+		return nil
+	}
+	var number float64
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*m = milliseconds(number * float64(time.Millisecond))
+	return nil
+}
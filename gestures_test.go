@@ -0,0 +1,77 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTouchMoveThreshold(t *testing.T) {
+	for value, expected := range map[string]string{
+		"5":          "5,5,5",
+		"10, 20,30":  "10,20,30",
+		"1,2":        "expected 1 or 3 distances",
+		"x":          "invalid distance",
+		"-1":         "not negative",
+		`"1,2,3"`:    "1,2,3",
+		`[4, 5, 6]`:  "4,5,6",
+		`[4, 5]`:     "expected 3 distances",
+		`[4, 5, -6]`: "not negative",
+	} {
+		var threshold touchMoveThreshold
+		var err error
+		if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "[") {
+			err = json.Unmarshal([]byte(value), &threshold)
+		} else {
+			err = threshold.Set(value)
+		}
+		actual := threshold.String()
+		if err != nil {
+			actual = err.Error()
+		}
+		if !strings.Contains(actual, expected) {
+			t.Errorf("%s: unexpected result: %s", value, actual)
+		}
+	}
+}
+
+func TestMilliseconds(t *testing.T) {
+	data, err := json.Marshal(milliseconds(1500 * time.Microsecond))
+	if err != nil || string(data) != "1.5" {
+		t.Fatalf("unexpected JSON: %s (%v)", data, err)
+	}
+	for value, expected := range map[string]time.Duration{
+		`300`:     300 * time.Millisecond,
+		`"0.5s"`:  500 * time.Millisecond,
+		`"300ms"`: 300 * time.Millisecond,
+	} {
+		var m milliseconds
+		if err := json.Unmarshal([]byte(value), &m); err != nil || time.Duration(m) != expected {
+			t.Errorf("%s: unexpected duration: %v (%v)", value, time.Duration(m), err)
+		}
+	}
+	var m milliseconds
+	if err := json.Unmarshal([]byte(`"soon"`), &m); err == nil {
+		t.Errorf("expected error, got %v", time.Duration(m))
+	}
+}
@@ -55,16 +55,23 @@ const (
 	KeyLimit
 )
 
+// Options configure the controllers. Controllers ignore options that don't
+// apply to them.
+type Options struct {
+	// Name of the keyboard mapping used by the uinput controller
+	UinputKeymap string
+}
+
 type ControllerInfo struct {
 	Name string
-	Init func() (Controller, error)
+	Init func(options Options) (Controller, error)
 
 	priority int
 }
 
 var Controllers []ControllerInfo
 
-func RegisterController(name string, init func() (Controller, error), priority int) {
+func RegisterController(name string, init func(options Options) (Controller, error), priority int) {
 	Controllers = append(Controllers, ControllerInfo{name, init, priority})
 	sort.SliceStable(Controllers, func(i, j int) bool {
 		return Controllers[i].priority < Controllers[j].priority
@@ -83,6 +90,20 @@ func (e *UnsupportedPlatformError) Unwrap() error {
 	return e.Err
 }
 
+// UnsupportedInputError is returned when a character, key or button can't be
+// sent with the controller. The controller remains usable.
+type UnsupportedInputError struct {
+	Err error
+}
+
+func (e *UnsupportedInputError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnsupportedInputError) Unwrap() error {
+	return e.Err
+}
+
 type Controller interface {
 	Close() error
 	KeyboardText(text string) error
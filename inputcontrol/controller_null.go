@@ -31,7 +31,7 @@ func init() {
 	RegisterController("null", InitNullController, 1000)
 }
 
-func InitNullController() (Controller, error) {
+func InitNullController(options Options) (Controller, error) {
 	return &nullController{}, nil
 }
 
@@ -63,7 +63,7 @@ func init() {
 	RegisterController("RemoteDesktop portal", InitPortalController, 1)
 }
 
-func InitPortalController() (Controller, error) {
+func InitPortalController(options Options) (Controller, error) {
 	bus, err := dbus.SessionBusPrivate()
 	if err != nil {
 		return nil, &UnsupportedPlatformError{err}
@@ -367,7 +367,7 @@ func (p *portalController) PointerButton(button PointerButton, press bool) error
 	case PointerButtonRight:
 		btn = btnRight
 	default:
-		return fmt.Errorf("unsupported pointer button: %#v", button)
+		return &UnsupportedInputError{fmt.Errorf("unsupported pointer button: %#v", button)}
 	}
 	state := btnReleased
 	if press {
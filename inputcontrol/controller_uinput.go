@@ -44,9 +44,9 @@ func init() {
 	RegisterController("uinput", InitUinputController, 10)
 }
 
-func InitUinputController() (Controller, error) {
-	keymapName, keymapSet := os.LookupEnv("REMOTE_TOUCHPAD_UINPUT_KEYMAP")
-	if !keymapSet {
+func InitUinputController(options Options) (Controller, error) {
+	keymapName := options.UinputKeymap
+	if keymapName == "" {
 		keymapName = "defkeymap"
 	}
 	keymap, err := LoadKeymap(keymapName)
@@ -68,8 +68,8 @@ func InitUinputController() (Controller, error) {
 		keyboard.Close()
 		return nil, err
 	}
-	if !keymapSet {
-		log.Print("Hint: Set the keyboard mapping with the REMOTE_TOUCHPAD_UINPUT_KEYMAP environment variable")
+	if options.UinputKeymap == "" {
+		log.Print("Hint: Set the keyboard mapping with the uinput-keymap option")
 	}
 	return &uinputController{keymap, keyboard, mouse}, nil
 }
@@ -115,7 +115,7 @@ func (p *uinputController) KeyboardText(text string) error {
 	for _, runeValue := range text {
 		keyCombo, found := p.keymap.Get(runeValue)
 		if !found {
-			return fmt.Errorf("unsupported rune: %q", runeValue)
+			return &UnsupportedInputError{fmt.Errorf("unsupported rune: %q", runeValue)}
 		}
 		if err := updateShiftKeys(keyCombo); err != nil {
 			return err
@@ -167,7 +167,7 @@ func (p *uinputController) KeyboardKey(key Key) error {
 	case KeyBrowserForward:
 		uinputKey = uinput.KeyForward
 	default:
-		return fmt.Errorf("unsupported key: %#v", key)
+		return &UnsupportedInputError{fmt.Errorf("unsupported key: %#v", key)}
 	}
 	return p.keyboard.KeyPress(uinputKey)
 }
@@ -187,7 +187,7 @@ func (p *uinputController) PointerButton(button PointerButton, press bool) error
 	case button == PointerButtonMiddle && !press:
 		return p.mouse.MiddleRelease()
 	default:
-		return fmt.Errorf("unsupported pointer button: %#v", button)
+		return &UnsupportedInputError{fmt.Errorf("unsupported pointer button: %#v", button)}
 	}
 }
 
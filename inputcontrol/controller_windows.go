@@ -95,7 +95,7 @@ func init() {
 	RegisterController("Windows", InitWindowsController, 0)
 }
 
-func InitWindowsController() (Controller, error) {
+func InitWindowsController(options Options) (Controller, error) {
 	p := &windowsController{}
 	if err := sendInputProc.Find(); err != nil {
 		return nil, &UnsupportedPlatformError{err}
@@ -172,7 +172,7 @@ func (p *windowsController) KeyboardKey(key Key) error {
 	case KeyMediaPlayPause:
 		input.wVk = vkMediaPlayPause
 	default:
-		return fmt.Errorf("key not mapped to virtual-key code: %#v", key)
+		return &UnsupportedInputError{fmt.Errorf("key not mapped to virtual-key code: %#v", key)}
 	}
 	inputs := [...]keybdInput{input, input}
 	inputs[1].dwFlags |= keyeventfKeyup
@@ -194,7 +194,7 @@ func (p *windowsController) PointerButton(button PointerButton, press bool) erro
 	} else if button == PointerButtonRight {
 		input.dwFlags = mouseeventfRightup
 	} else {
-		return fmt.Errorf("unsupported pointer button: %#v", button)
+		return &UnsupportedInputError{fmt.Errorf("unsupported pointer button: %#v", button)}
 	}
 	if sent, _, err := sendInputProc.Call(1, uintptr(unsafe.Pointer(&input)),
 		unsafe.Sizeof(input)); int(sent) != 1 {
@@ -68,7 +68,7 @@ func init() {
 	RegisterController("X11", InitX11Controller, 0)
 }
 
-func InitX11Controller() (Controller, error) {
+func InitX11Controller(options Options) (Controller, error) {
 	display := C.XOpenDisplay(nil)
 	if display == nil {
 		return nil, &UnsupportedPlatformError{
@@ -340,7 +340,7 @@ func (p *x11Controller) PointerButton(button PointerButton, press bool) error {
 	case PointerButtonMiddle:
 		return p.sendButton(2, press)
 	default:
-		return fmt.Errorf("unsupported pointer button: %#v", button)
+		return &UnsupportedInputError{fmt.Errorf("unsupported pointer button: %#v", button)}
 	}
 }
 
@@ -0,0 +1,72 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import "time"
+
+const (
+	// Weight of new samples in the moving averages
+	latencySmoothing float64 = 0.125
+	// Interval of the summaries in the log during long sessions
+	latencyLogInterval time.Duration = time.Minute
+)
+
+// movingAverage is an exponentially weighted moving average of durations.
+type movingAverage struct {
+	value   time.Duration
+	samples int
+}
+
+func (a *movingAverage) add(sample time.Duration) {
+	if a.samples == 0 {
+		a.value = sample
+	} else {
+		a.value += time.Duration(latencySmoothing * float64(sample-a.value))
+	}
+	a.samples++
+}
+
+// latencyStats measures the round-trip time of the connection and the
+// duration of controller calls of a client, to tell slow networks apart from
+// slow controllers. It's only used by the goroutine that handles the messages
+// of the client.
+type latencyStats struct {
+	roundTrip  movingAverage
+	controller movingAverage
+	// Start of the interval of the next summary in the log
+	logged time.Time
+}
+
+// logDue reports whether the next summary should be logged and starts a new
+// interval.
+func (s *latencyStats) logDue(now time.Time) bool {
+	if s.logged.IsZero() {
+		s.logged = now
+	}
+	if now.Sub(s.logged) < latencyLogInterval {
+		return false
+	}
+	s.logged = now
+	return true
+}
+
+func durationMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
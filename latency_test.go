@@ -0,0 +1,51 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMovingAverage(t *testing.T) {
+	var a movingAverage
+	a.add(8 * time.Millisecond)
+	if a.value != 8*time.Millisecond {
+		t.Fatalf("unexpected average: %v", a.value)
+	}
+	a.add(16 * time.Millisecond)
+	if a.value != 9*time.Millisecond || a.samples != 2 {
+		t.Fatalf("unexpected average: %v (%d samples)", a.value, a.samples)
+	}
+}
+
+func TestLatencyLogDue(t *testing.T) {
+	var stats latencyStats
+	now := time.Now()
+	if stats.logDue(now) || stats.logDue(now.Add(latencyLogInterval-time.Second)) {
+		t.Fatal("log due within interval")
+	}
+	if !stats.logDue(now.Add(latencyLogInterval)) {
+		t.Fatal("log not due after interval")
+	}
+	if stats.logDue(now.Add(latencyLogInterval + time.Second)) {
+		t.Fatal("log due again within interval")
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+type lockedOutError struct {
+	retryAfter time.Duration
+}
+
+func (e *lockedOutError) Error() string {
+	return fmt.Sprintf("too many failed authentication attempts, retry in %v",
+		e.retryAfter.Round(time.Second))
+}
+
+type authFailures struct {
+	count       int
+	retryAt     time.Time
+	bannedUntil time.Time
+}
+
+// authLockout counts failed authentication attempts per source address.
+// After every failure, the address has to wait for an exponentially growing
+// delay before the next attempt. Addresses get banned temporarily when the
+// number of failures reaches maxFailures.
+type authLockout struct {
+	mutex       sync.Mutex
+	failures    map[string]*authFailures
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	maxFailures int
+	banDuration time.Duration
+}
+
+func newAuthLockout(backoff time.Duration, maxFailures int, banDuration time.Duration) *authLockout {
+	return &authLockout{
+		failures:    make(map[string]*authFailures),
+		backoff:     backoff,
+		maxBackoff:  maxAuthBackoff,
+		maxFailures: maxFailures,
+		banDuration: banDuration,
+	}
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// attempt runs the authentication unless the address is locked out. The
+// authentication runs without holding the lockout, because it can read the
+// devices file or wait for the client. Concurrent attempts from an address
+// that isn't locked out all count, so that they still lead to a ban.
+func (l *authLockout) attempt(remoteAddr string, authenticate func() error) error {
+	if err := l.check(remoteAddr); err != nil {
+		return err
+	}
+	return l.record(remoteAddr, authenticate())
+}
+
+// record counts the result of an authentication.
+func (l *authLockout) record(remoteAddr string, err error) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.recordLocked(remoteHost(remoteAddr), time.Now(), err)
+}
+
+func (l *authLockout) recordLocked(host string, now time.Time, err error) error {
+	failures := l.failures[host]
+	if err == nil {
+		delete(l.failures, host)
+		return nil
+	}
+	if !errors.Is(err, errAuthentication) {
+		return err
+	}
+	if failures == nil {
+		failures = &authFailures{}
+		l.failures[host] = failures
+	}
+	failures.count++
+	delay := l.backoff
+	for i := 1; i < failures.count && delay < l.maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, l.maxBackoff)
+	failures.retryAt = now.Add(delay)
+	if l.maxFailures > 0 && failures.count >= l.maxFailures {
+		failures.count = 0
+		failures.bannedUntil = now.Add(l.banDuration)
+		log.Printf("Banned %s for %v after %d failed authentication attempts",
+			host, l.banDuration, l.maxFailures)
+	} else {
+		log.Printf("Failed authentication attempt from %s (retry in %v)", host, delay)
+	}
+	return err
+}
+
+// check reports whether the address is locked out, without attempting an
+// authentication.
+func (l *authLockout) check(remoteAddr string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.checkLocked(remoteHost(remoteAddr), time.Now())
+}
+
+func (l *authLockout) checkLocked(host string, now time.Time) error {
+	l.cleanupLocked(now)
+	if failures := l.failures[host]; failures != nil {
+		retryAt := failures.retryAt
+		if failures.bannedUntil.After(retryAt) {
+			retryAt = failures.bannedUntil
+		}
+		if now.Before(retryAt) {
+			return &lockedOutError{retryAt.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// cleanupLocked forgets addresses that haven't failed for the maximum backoff.
+func (l *authLockout) cleanupLocked(now time.Time) {
+	for host, failures := range l.failures {
+		if now.After(failures.retryAt.Add(l.maxBackoff)) &&
+			now.After(failures.bannedUntil) {
+			delete(l.failures, host)
+		}
+	}
+}
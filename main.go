@@ -20,22 +20,24 @@
 package main
 
 import (
-	"crypto/hmac"
+	"context"
 	"crypto/rand"
-	"crypto/sha256"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	mathrand "math/rand"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
-	"unicode/utf8"
 
 	"github.com/unrud/remote-touchpad/inputcontrol"
 	"github.com/unrud/remote-touchpad/terminal"
@@ -43,103 +45,68 @@ import (
 )
 
 const (
-	defaultSecretLength     int           = 8
-	authenticationRateLimit time.Duration = time.Second / 10
-	authenticationRateBurst int           = 10
-	challengeLength         int           = 8
-	defaultBind             string        = ":0"
-	version                 string        = "1.5.4"
-	prettyAppName           string        = "Remote Touchpad"
+	defaultSecretLength    int           = 8
+	defaultAuthBackoff     time.Duration = time.Second
+	maxAuthBackoff         time.Duration = 5 * time.Minute
+	defaultAuthMaxFailures int           = 10
+	defaultAuthBanDuration time.Duration = 15 * time.Minute
+	challengeLength        int           = 32
+	challengeTimeout       time.Duration = 30 * time.Second
+	pinExchangeTimeout     time.Duration = 5 * time.Second
+	defaultBind            string        = ":0"
+	defaultPingInterval    time.Duration = 10 * time.Second
+	defaultPingTimeout     time.Duration = 30 * time.Second
+	defaultResumeTimeout   time.Duration = 30 * time.Second
+	shutdownTimeout        time.Duration = 5 * time.Second
+	version                string        = "1.5.4"
+	prettyAppName          string        = "Remote Touchpad"
+	maxUpdateRate          uint          = 1000
+	maxSpeed               float64       = 100
 )
 
 type config struct {
-	UpdateRate       uint    `json:"updateRate"`
-	ScrollSpeed      float64 `json:"scrollSpeed"`
-	MoveSpeed        float64 `json:"moveSpeed"`
-	MouseScrollSpeed float64 `json:"mouseScrollSpeed"`
-	MouseMoveSpeed   float64 `json:"mouseMoveSpeed"`
+	UpdateRate            uint                `json:"updateRate"`
+	ScrollSpeed           float64             `json:"scrollSpeed"`
+	MoveSpeed             float64             `json:"moveSpeed"`
+	MouseScrollSpeed      float64             `json:"mouseScrollSpeed"`
+	MouseMoveSpeed        float64             `json:"mouseMoveSpeed"`
+	Acceleration          accelerationProfile `json:"acceleration"`
+	TouchMoveThreshold    touchMoveThreshold  `json:"touchMoveThreshold"`
+	TouchTimeout          milliseconds        `json:"touchTimeout"`
+	TapToDrag             bool                `json:"tapToDrag"`
+	NaturalScrolling      bool                `json:"naturalScrolling"`
+	MouseNaturalScrolling bool                `json:"mouseNaturalScrolling"`
+	ScrollAxisLock        bool                `json:"scrollAxisLock"`
 }
 
-func processCommand(controller inputcontrol.Controller, command string) error {
-	if len(command) == 0 {
-		return errors.New("empty command")
+// validate checks the config from the command line and the settings of
+// clients.
+func (c config) validate() error {
+	if c.UpdateRate == 0 || c.UpdateRate > maxUpdateRate {
+		return fmt.Errorf("update-rate: must be between 1 and %d", maxUpdateRate)
 	}
-	if command == "S" {
-		return controller.PointerScroll(0, 0, true)
-	}
-	if command[0] == 't' {
-		text := command[1:]
-		if !utf8.ValidString(text) {
-			return errors.New("invalid utf-8")
+	for _, speed := range []struct {
+		name  string
+		value float64
+	}{
+		{"move-speed", c.MoveSpeed}, {"scroll-speed", c.ScrollSpeed},
+		{"mouse-move-speed", c.MouseMoveSpeed}, {"mouse-scroll-speed", c.MouseScrollSpeed},
+	} {
+		// Also rejects NaN
+		if !(speed.value > 0 && speed.value <= maxSpeed) {
+			return fmt.Errorf("%s: must be positive and not higher than %g", speed.name, maxSpeed)
 		}
-		return controller.KeyboardText(text)
-	}
-	arguments := strings.Split(command[1:], ";")
-	if command[0] == 'k' && len(arguments) != 1 ||
-		command[0] != 'k' && len(arguments) != 2 {
-		return errors.New("wrong number of arguments")
-	}
-	x, err := strconv.ParseInt(arguments[0], 10, 32)
-	if err != nil {
-		return err
-	}
-	if command[0] == 'k' {
-		if x < 0 || x >= int64(inputcontrol.KeyLimit) {
-			return errors.New("unsupported key")
-		}
-		return controller.KeyboardKey(inputcontrol.Key(x))
-	}
-	y, err := strconv.ParseInt(arguments[1], 10, 32)
-	if err != nil {
-		return err
-	}
-	if command[0] == 'm' {
-		return controller.PointerMove(int(x), int(y))
 	}
-	if command[0] == 's' {
-		return controller.PointerScroll(int(x), int(y), false)
+	if err := c.Acceleration.validate(); err != nil {
+		return fmt.Errorf("acceleration: %w", err)
 	}
-	if command[0] == 'S' {
-		return controller.PointerScroll(int(x), int(y), true)
+	if err := c.TouchMoveThreshold.validate(); err != nil {
+		return fmt.Errorf("touch-move-threshold: %w", err)
 	}
-	if command[0] == 'b' {
-		if x < 0 || x >= int64(inputcontrol.PointerButtonLimit) {
-			return errors.New("unsupported pointer button")
-		}
-		b := true
-		if y == 0 {
-			b = false
-		}
-		return controller.PointerButton(inputcontrol.PointerButton(x), b)
-	}
-	return errors.New("unsupported command")
-}
-
-type challenge struct {
-	message, expectedResponse string
-}
-
-func (c challenge) verify(response string) bool {
-	return c.expectedResponse == response
-}
-
-func authenticationChallengeGenerator(secret string, challenges chan<- challenge) {
-	unsecureSource := mathrand.NewSource(time.Now().UnixNano())
-	unsecureRand := mathrand.New(unsecureSource)
-	b := make([]byte, challengeLength)
-	for {
-		if _, err := unsecureRand.Read(b[:]); err != nil {
-			log.Fatal(err)
-		}
-		message := base64.StdEncoding.EncodeToString(b[:])
-		mac := hmac.New(sha256.New, []byte(message))
-		mac.Write([]byte(secret))
-		challenges <- challenge{
-			message:          message,
-			expectedResponse: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
-		}
-		time.Sleep(authenticationRateLimit)
+	if c.TouchTimeout <= 0 {
+		return errors.New("touch-timeout: must be positive")
 	}
+	return nil
 }
 
 func secureRandBase64(length int) string {
@@ -150,46 +117,84 @@ func secureRandBase64(length int) string {
 	return base64.StdEncoding.EncodeToString(b[:])
 }
 
+// reloadConfig parses the command line and the configuration file again and
+// sends the new config to all clients. Other options require a restart.
+func reloadConfig(server *server) {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	o, err := parseOptions(flags, os.Args[1:])
+	if err != nil {
+		log.Printf("Failed to reload configuration: %v", err)
+		return
+	}
+	server.updateConfig(o.config, o.userConfigs)
+	log.Print("Reloaded configuration")
+}
+
 func main() {
 	terminal.SetTitle(prettyAppName)
-	var bind, certFile, keyFile, secret string
-	var showVersion bool
-	var config config
-	flag.BoolVar(&showVersion, "version", false, "show program's version number and exit")
-	flag.StringVar(&bind, "bind", defaultBind, "bind server to [HOSTNAME]:PORT")
-	flag.StringVar(&secret, "secret", "", "shared secret for client authentication")
-	flag.StringVar(&certFile, "cert", "", "file containing TLS certificate")
-	flag.StringVar(&keyFile, "key", "", "file containing TLS private key")
-	flag.UintVar(&config.UpdateRate, "update-rate", 30, "number of updates per second")
-	flag.Float64Var(&config.MoveSpeed, "move-speed", 1, "move speed multiplier")
-	flag.Float64Var(&config.ScrollSpeed, "scroll-speed", 1, "scroll speed multiplier")
-	flag.Float64Var(&config.MouseMoveSpeed, "mouse-move-speed", 1, "mouse move speed multiplier")
-	flag.Float64Var(&config.MouseScrollSpeed, "mouse-scroll-speed", 1, "mouse scroll speed multiplier")
-	flag.Parse()
-	if showVersion {
+	o, err := parseOptions(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if o.showVersion {
 		fmt.Println(version)
 		return
 	}
-	if certFile != "" && keyFile == "" {
-		log.Fatal("TLS private key file missing")
+	var devices *deviceStore
+	if o.devicesFile != "" {
+		devices = newDeviceStore(o.devicesFile)
+	}
+	if o.listDevices || o.revokeDevice != "" {
+		if devices == nil {
+			log.Fatal("pairing is disabled")
+		}
+		if o.revokeDevice != "" {
+			if err := devices.revoke(o.revokeDevice); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Revoked device %s\n", o.revokeDevice)
+		}
+		if o.listDevices {
+			if err := printDevices(devices); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
 	}
-	if certFile == "" && keyFile != "" {
-		log.Fatal("TLS certificate file missing")
+	tlsEnabled := o.certFile != "" && o.keyFile != "" || o.selfSigned
+	secret := o.secret
+	if o.secretFile != "" {
+		data, err := os.ReadFile(o.secretFile)
+		if err != nil {
+			log.Fatalf("secret-file: %v", err)
+		}
+		if secret = strings.TrimSpace(string(data)); secret == "" {
+			log.Fatalf("secret-file: %s is empty", o.secretFile)
+		}
 	}
-	tls := certFile != "" && keyFile != ""
 	if secret == "" {
 		secret = secureRandBase64(defaultSecretLength)
 	}
 	if len(inputcontrol.Controllers) == 0 {
 		log.Fatal("compiled without controller")
 	}
+	controllers := inputcontrol.Controllers
+	if o.controllerSelection != "" {
+		controllers = slices.DeleteFunc(slices.Clone(controllers), func(info inputcontrol.ControllerInfo) bool {
+			return !strings.EqualFold(info.Name, o.controllerSelection)
+		})
+		if len(controllers) == 0 {
+			log.Fatalf("controller: unknown controller %#v", o.controllerSelection)
+		}
+	}
 	var controller inputcontrol.Controller
 	var controllerName string
 	var platformErrs []error
-	for _, controllerInfo := range inputcontrol.Controllers {
+	for _, controllerInfo := range controllers {
 		controllerName = controllerInfo.Name
 		var err error
-		controller, err = controllerInfo.Init()
+		controller, err = controllerInfo.Init(o.controllerOptions)
 		if err == nil {
 			break
 		} else {
@@ -205,16 +210,21 @@ func main() {
 	if controller == nil {
 		log.Fatal(fmt.Errorf("unsupported platform:\n%w", errors.Join(platformErrs...)))
 	}
-	defer controller.Close()
-	authenticationChallenges := make(chan challenge, authenticationRateBurst)
-	go authenticationChallengeGenerator(secret, authenticationChallenges)
-	listener, err := net.Listen("tcp", bind)
+	if axes, ok := o.invertScroll[strings.ToLower(controllerName)]; ok {
+		controller = &invertingController{Controller: controller, axes: axes}
+	}
+	if o.smoothingRate > 0 {
+		controller = newSmoothingController(controller, o.smoothingRate, o.smoothingLatency)
+	}
+	credentials := append([]*credential{{secret: secret, scopes: allScopes}}, o.users...)
+	credentials = append(credentials, o.guests...)
+	listener, err := net.Listen("tcp", o.bind)
 	if err != nil {
 		log.Fatal(err)
 	}
 	addr := listener.Addr().(*net.TCPAddr)
 	host := ""
-	bindHost, _, err := net.SplitHostPort(bind)
+	bindHost, _, err := net.SplitHostPort(o.bind)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -230,50 +240,134 @@ func main() {
 	port := addr.Port
 	mux := http.NewServeMux()
 	mux.Handle("/", http.FileServer(http.FS(webdataFS)))
-	mux.Handle("/ws", websocket.Handler(func(ws *websocket.Conn) {
-		var message string
-		challenge := <-authenticationChallenges
-		websocket.Message.Send(ws, challenge.message)
-		if err := websocket.Message.Receive(ws, &message); err != nil {
-			return
-		}
-		if !challenge.verify(message) {
-			return
-		}
-		websocket.JSON.Send(ws, config)
-		for {
-			if err := websocket.Message.Receive(ws, &message); err != nil {
-				return
-			}
-			if err := processCommand(controller, message); err != nil {
-				log.Print(fmt.Errorf("%s controller: %w", controllerName, err))
-				return
-			}
-		}
-	}))
+	server := &server{
+		controllerName:     controllerName,
+		config:             o.config,
+		userConfigs:        o.userConfigs,
+		credentials:        credentials,
+		lockout:            newAuthLockout(o.authBackoff, o.authMaxFailures, o.authBanDuration),
+		devices:            devices,
+		clientCertificates: o.clientCertificates,
+		challengeTimeout:   challengeTimeout,
+		legacyAuth:         o.legacyAuth,
+		requireEncryption:  o.requireEncryption,
+		pingInterval:       o.pingInterval,
+		pingTimeout:        o.pingTimeout,
+		adaptiveUpdateRate: o.adaptiveUpdateRate,
+		minUpdateRate:      o.minUpdateRate,
+		maxUpdateRate:      o.maxUpdateRate,
+		sessions:           newSessionRegistry(controller, o.resumeTimeout),
+	}
+	server.sessions.policy = o.clientPolicy
+	server.sessions.maxClients = o.maxClients
+	mux.Handle("/ws", websocket.Handler(server.handleWebSocket))
 	domain := host
-	if port != 80 && !tls || port != 443 && tls {
+	if port != 80 && !tlsEnabled || port != 443 && tlsEnabled {
 		domain = net.JoinHostPort(host, strconv.Itoa(port))
 	}
 	scheme := "http"
-	if tls {
+	var certificate tls.Certificate
+	fragmentSuffix := ""
+	if tlsEnabled {
 		scheme = "https"
+		if o.selfSigned {
+			certFile, keyFile := o.certFile, o.keyFile
+			if certFile == "" {
+				certFile, keyFile = defaultSelfSignedPaths()
+			}
+			if certFile == "" {
+				log.Fatal("self-signed: no configuration directory, set cert and key")
+			}
+			certificate, err = loadSelfSignedCertificate(certFile, keyFile, host)
+		} else {
+			certificate, err = tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fingerprint, fingerprintHex := certificateFingerprint(certificate)
+		fragmentSuffix = fingerprintPrefix + fingerprint
+		fmt.Printf("Certificate fingerprint (SHA-256): %s\n", fingerprintHex)
+	}
+	url := fmt.Sprintf("%s://%s/#%s%s", scheme, domain, secret, fragmentSuffix)
+	for _, user := range o.users {
+		fmt.Printf("User %s (%s): %s://%s/#%s%s\n", user.user, strings.Join(user.scopes, ", "),
+			scheme, domain, user.secret, fragmentSuffix)
+	}
+	for _, guest := range o.guests {
+		fmt.Printf("Guest (%s): %s://%s/#%s%s\n", strings.Join(guest.scopes, ", "),
+			scheme, domain, guest.secret, fragmentSuffix)
 	}
-	url := fmt.Sprintf("%s://%s/#%s", scheme, domain, secret)
 	fmt.Println(url)
 	if qrCode, err := terminal.GenerateQRCode(url, terminal.SupportsColor(os.Stdout.Fd())); err == nil {
 		fmt.Print(qrCode)
 	} else {
 		log.Printf("QR code error: %v", err)
 	}
-	if !tls {
+	if o.pinPairing {
+		pinURL := fmt.Sprintf("%s://%s/", scheme, domain)
+		if fragmentSuffix != "" {
+			pinURL += "#" + fragmentSuffix
+		}
+		server.pins = newPINPairing(func(pin string) {
+			fmt.Printf("PIN for pairing at %s: %s\n", pinURL, pin)
+		})
+	}
+	if !tlsEnabled {
 		fmt.Println("▌   WARNING: TLS is not enabled    ▐")
 		fmt.Println("▌Don't use in an untrusted network!▐")
 	}
-	if tls {
-		err = http.ServeTLS(listener, mux, certFile, keyFile)
-	} else {
-		err = http.Serve(listener, mux)
+	httpServer := &http.Server{
+		Handler:   mux,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{certificate}},
+	}
+	if o.clientCA != "" {
+		clientCAs, err := loadClientCAs(o.clientCA)
+		if err != nil {
+			log.Fatalf("client-ca: %v", err)
+		}
+		// Clients without certificate authenticate with the secret
+		httpServer.TLSConfig.ClientCAs = clientCAs
+		httpServer.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	serveErrs := make(chan error, 1)
+	go func() {
+		if tlsEnabled {
+			serveErrs <- httpServer.ServeTLS(listener, "", "")
+		} else {
+			serveErrs <- httpServer.Serve(listener)
+		}
+	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	reloads := make(chan struct{})
+	go watchReload(o.configFile, reloads)
+	var serveErr error
+loop:
+	for {
+		select {
+		case serveErr = <-serveErrs:
+			break loop
+		case sig := <-signals:
+			log.Printf("Received %v, shutting down", sig)
+			break loop
+		case <-reloads:
+			reloadConfig(server)
+		}
+	}
+	// Repeated signals terminate immediately
+	signal.Stop(signals)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Print(err)
+	}
+	// Releases held pointer buttons
+	server.sessions.closeAll()
+	if err := controller.Close(); err != nil {
+		log.Print(fmt.Errorf("%s controller: %w", controllerName, err))
+	}
+	if serveErr != nil {
+		log.Fatal(serveErr)
 	}
-	log.Fatal(err)
 }
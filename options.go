@@ -0,0 +1,270 @@
+/*
+ *    Copyright (c) 2018-2019, 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/unrud/remote-touchpad/inputcontrol"
+)
+
+// options are the settings from the command line and the configuration file.
+type options struct {
+	configFile          string
+	showVersion         bool
+	bind                string
+	secret              string
+	secretFile          string
+	guests              []*credential
+	users               []*credential
+	userConfigs         map[string]configOverrides
+	legacyAuth          bool
+	requireEncryption   bool
+	authBackoff         time.Duration
+	authMaxFailures     int
+	authBanDuration     time.Duration
+	devicesFile         string
+	listDevices         bool
+	revokeDevice        string
+	pinPairing          bool
+	certFile            string
+	keyFile             string
+	selfSigned          bool
+	clientCA            string
+	clientCertificates  []clientCertificate
+	pingInterval        time.Duration
+	pingTimeout         time.Duration
+	resumeTimeout       time.Duration
+	clientPolicy        string
+	maxClients          int
+	controllerSelection string
+	controllerOptions   inputcontrol.Options
+	invertScroll        map[string]scrollAxes
+	smoothingRate       uint
+	smoothingLatency    time.Duration
+	adaptiveUpdateRate  bool
+	minUpdateRate       uint
+	maxUpdateRate       uint
+	config              config
+}
+
+func defineFlags(flags *flag.FlagSet, o *options) {
+	flags.StringVar(&o.configFile, "config", defaultConfigFilePath(), "configuration file with a JSON object of option names and values")
+	flags.BoolVar(&o.showVersion, "version", false, "show program's version number and exit")
+	flags.StringVar(&o.bind, "bind", defaultBind, "bind server to [HOSTNAME]:PORT")
+	flags.StringVar(&o.secret, "secret", "", "shared secret for client authentication")
+	flags.StringVar(&o.secretFile, "secret-file", "", "file containing the shared secret")
+	flags.Func("guest", "add guest access restricted to SCOPE[,SCOPE...][:SECRET] (scopes: "+
+		strings.Join(allScopes, ", ")+")", func(value string) error {
+		scopesValue, secret, _ := strings.Cut(value, ":")
+		scopes, err := parseScopes(scopesValue)
+		if err != nil {
+			return err
+		}
+		if secret == "" {
+			secret = secureRandBase64(defaultSecretLength)
+		}
+		o.guests = append(o.guests, &credential{secret: secret, scopes: scopes})
+		return nil
+	})
+	flags.Func("user", "add user with individual secret, scopes and config as JSON object with the keys name, secret, "+
+		"scopes and the names of config options", func(value string) error {
+		user, overrides, err := parseUser(value)
+		if err != nil {
+			return err
+		}
+		if _, exists := o.userConfigs[user.user]; exists {
+			return fmt.Errorf("duplicate user %#v", user.user)
+		}
+		if o.userConfigs == nil {
+			o.userConfigs = make(map[string]configOverrides)
+		}
+		o.users = append(o.users, user)
+		o.userConfigs[user.user] = overrides
+		return nil
+	})
+	flags.BoolVar(&o.legacyAuth, "legacy-auth", true, "accept the authentication scheme of old clients")
+	flags.BoolVar(&o.requireEncryption, "require-encryption", false, "reject clients that don't encrypt their messages, unless TLS is used")
+	flags.DurationVar(&o.authBackoff, "auth-backoff", defaultAuthBackoff, "delay after a failed authentication attempt, doubled for every further failure")
+	flags.IntVar(&o.authMaxFailures, "auth-max-failures", defaultAuthMaxFailures, "ban addresses after this number of failed authentication attempts (0 to disable)")
+	flags.DurationVar(&o.authBanDuration, "auth-ban-duration", defaultAuthBanDuration, "duration of bans for failed authentication attempts")
+	flags.StringVar(&o.devicesFile, "devices", defaultDeviceStorePath(), "file for storing paired devices (empty to disable pairing)")
+	flags.BoolVar(&o.listDevices, "list-devices", false, "show paired devices and exit")
+	flags.StringVar(&o.revokeDevice, "revoke-device", "", "remove paired device with ID and exit")
+	flags.BoolVar(&o.pinPairing, "pin-pairing", false, "allow pairing of devices with a PIN that is shown in the terminal")
+	flags.StringVar(&o.certFile, "cert", "", "file containing TLS certificate")
+	flags.StringVar(&o.keyFile, "key", "", "file containing TLS private key")
+	flags.StringVar(&o.clientCA, "client-ca", "", "file containing CA certificates for the verification of client certificates")
+	flags.Func("client-cert", "grant access restricted to SCOPE[,SCOPE...]:SUBJECT to clients with a certificate for SUBJECT "+
+		"(common name, complete subject or "+anySubject+")", func(value string) error {
+		scopesValue, subject, found := strings.Cut(value, ":")
+		if !found || subject == "" {
+			return errors.New("subject missing")
+		}
+		scopes, err := parseScopes(scopesValue)
+		if err != nil {
+			return err
+		}
+		o.clientCertificates = append(o.clientCertificates, clientCertificate{
+			subject: subject, credential: &credential{scopes: scopes},
+		})
+		return nil
+	})
+	flags.BoolVar(&o.selfSigned, "self-signed", false, "enable TLS with a self-signed certificate, that is stored in the cert and key files (default: in the configuration directory)")
+	flags.DurationVar(&o.pingInterval, "ping-interval", defaultPingInterval, "interval between keepalive pings")
+	flags.DurationVar(&o.pingTimeout, "ping-timeout", defaultPingTimeout, "disconnect clients that are silent for this duration")
+	flags.DurationVar(&o.resumeTimeout, "resume-timeout", defaultResumeTimeout, "time for clients to resume lost connections")
+	flags.StringVar(&o.clientPolicy, "client-policy", policyShared, "handling of multiple clients: "+strings.Join(clientPolicies, ", "))
+	flags.IntVar(&o.maxClients, "max-clients", 0, "maximum number of clients (0 for unlimited)")
+	var controllerNames []string
+	for _, controllerInfo := range inputcontrol.Controllers {
+		controllerNames = append(controllerNames, controllerInfo.Name)
+	}
+	flags.StringVar(&o.controllerSelection, "controller", "", "use controller with NAME instead of the first supported one: "+strings.Join(controllerNames, ", "))
+	flags.Func("invert-scroll", "invert scrolling of the controller with NAME along the axes as NAME:AXIS[,AXIS] (axes: "+
+		scrollHorizontal+", "+scrollVertical+")", func(value string) error {
+		name, axesValue, found := strings.Cut(value, ":")
+		if !found {
+			return errors.New("axes missing")
+		}
+		if !slices.ContainsFunc(controllerNames, func(controllerName string) bool {
+			return strings.EqualFold(controllerName, name)
+		}) {
+			return fmt.Errorf("unknown controller %#v", name)
+		}
+		axes, err := parseScrollAxes(axesValue)
+		if err != nil {
+			return err
+		}
+		if o.invertScroll == nil {
+			o.invertScroll = make(map[string]scrollAxes)
+		}
+		o.invertScroll[strings.ToLower(name)] = axes
+		return nil
+	})
+	flags.UintVar(&o.smoothingRate, "smoothing-rate", 0, "split pointer movements into steps with this number per second (0 to disable)")
+	flags.DurationVar(&o.smoothingLatency, "smoothing-latency", defaultSmoothingLatency, "max delay of pointer movements by smoothing")
+	flags.StringVar(&o.controllerOptions.UinputKeymap, "uinput-keymap", os.Getenv("REMOTE_TOUCHPAD_UINPUT_KEYMAP"), "keyboard mapping of the uinput controller")
+	flags.UintVar(&o.config.UpdateRate, "update-rate", 30, "number of updates per second")
+	flags.BoolVar(&o.adaptiveUpdateRate, "adaptive-update-rate", false, "adapt the update rate of clients to the load of the controller and the network")
+	flags.UintVar(&o.minUpdateRate, "min-update-rate", defaultMinUpdateRate, "lower limit of the adaptive update rate")
+	flags.UintVar(&o.maxUpdateRate, "max-update-rate", defaultMaxUpdateRate, "upper limit of the adaptive update rate")
+	flags.Float64Var(&o.config.MoveSpeed, "move-speed", 1, "move speed multiplier")
+	flags.Float64Var(&o.config.ScrollSpeed, "scroll-speed", 1, "scroll speed multiplier")
+	flags.Float64Var(&o.config.MouseMoveSpeed, "mouse-move-speed", 1, "mouse move speed multiplier")
+	flags.Float64Var(&o.config.MouseScrollSpeed, "mouse-scroll-speed", 1, "mouse scroll speed multiplier")
+	o.config.Acceleration = defaultAcceleration
+	flags.Var(&o.config.Acceleration, "acceleration", "pointer acceleration profile: "+strings.Join(accelerationProfiles, ", ")+
+		" or SPEED:FACTOR[,SPEED:FACTOR...] with the speed in pixels per second")
+	o.config.TouchMoveThreshold = defaultTouchMoveThreshold
+	flags.Var(&o.config.TouchMoveThreshold, "touch-move-threshold", "distance in pixels that one, two and three touches "+
+		"must move before they no longer count as tap as DISTANCE[,DISTANCE,DISTANCE]")
+	flags.DurationVar((*time.Duration)(&o.config.TouchTimeout), "touch-timeout", time.Duration(defaultTouchTimeout),
+		"max time between consecutive touches for clicking or dragging")
+	flags.BoolVar(&o.config.TapToDrag, "tap-to-drag", true, "drag when touching again right after a tap")
+	flags.BoolVar(&o.config.NaturalScrolling, "natural-scrolling", true, "scroll the content in the direction of the fingers")
+	flags.BoolVar(&o.config.MouseNaturalScrolling, "mouse-natural-scrolling", false, "invert the scroll direction of the mouse wheel")
+	flags.BoolVar(&o.config.ScrollAxisLock, "scroll-axis-lock", false, "only scroll along the main axis of scroll gestures")
+}
+
+// parseOptions parses the command line arguments and loads the configuration
+// file.
+func parseOptions(flags *flag.FlagSet, arguments []string) (*options, error) {
+	o := &options{}
+	defineFlags(flags, o)
+	if err := flags.Parse(arguments); err != nil {
+		return nil, err
+	}
+	if o.showVersion {
+		return o, nil
+	}
+	if o.configFile != "" {
+		configFileSet := false
+		flags.Visit(func(f *flag.Flag) { configFileSet = configFileSet || f.Name == "config" })
+		if err := loadConfigFile(flags, o.configFile, configFileSet); err != nil {
+			return nil, err
+		}
+	}
+	return o, o.validate()
+}
+
+func (o *options) validate() error {
+	if o.certFile != "" && o.keyFile == "" {
+		return errors.New("key: TLS private key file missing")
+	}
+	if o.certFile == "" && o.keyFile != "" {
+		return errors.New("cert: TLS certificate file missing")
+	}
+	if o.clientCA != "" && o.certFile == "" && !o.selfSigned {
+		return errors.New("client-ca: requires TLS")
+	}
+	if o.clientCA != "" && len(o.clientCertificates) == 0 {
+		return errors.New("client-cert: missing, required by client-ca")
+	}
+	if o.clientCA == "" && len(o.clientCertificates) > 0 {
+		return errors.New("client-ca: missing, required by client-cert")
+	}
+	if o.secret != "" && o.secretFile != "" {
+		return errors.New("secret-file: can't be combined with secret")
+	}
+	if o.pingInterval > 0 && o.pingTimeout > 0 && o.pingTimeout <= o.pingInterval {
+		return errors.New("ping-timeout: must be longer than ping-interval")
+	}
+	if !slices.Contains(clientPolicies, o.clientPolicy) {
+		return fmt.Errorf("client-policy: invalid value %#v", o.clientPolicy)
+	}
+	if o.maxClients < 0 {
+		return errors.New("max-clients: must not be negative")
+	}
+	if o.authBackoff < 0 {
+		return errors.New("auth-backoff: must not be negative")
+	}
+	if o.authMaxFailures < 0 {
+		return errors.New("auth-max-failures: must not be negative")
+	}
+	if o.authBanDuration < 0 {
+		return errors.New("auth-ban-duration: must not be negative")
+	}
+	if o.minUpdateRate == 0 {
+		return errors.New("min-update-rate: must be positive")
+	}
+	if o.maxUpdateRate < o.minUpdateRate {
+		return errors.New("max-update-rate: must not be lower than min-update-rate")
+	}
+	if o.maxUpdateRate > maxUpdateRate {
+		return fmt.Errorf("max-update-rate: must not be higher than %d", maxUpdateRate)
+	}
+	if o.smoothingRate > maxSmoothingRate {
+		return fmt.Errorf("smoothing-rate: must not be higher than %d", maxSmoothingRate)
+	}
+	if o.smoothingLatency < 0 || o.smoothingLatency > maxSmoothingLatency {
+		return fmt.Errorf("smoothing-latency: must be between 0 and %v", maxSmoothingLatency)
+	}
+	if o.pinPairing && o.devicesFile == "" {
+		return errors.New("pin-pairing: requires devices")
+	}
+	return o.config.validate()
+}
@@ -0,0 +1,193 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+)
+
+// PIN pairing uses SPAKE2 in the 2048-bit MODP group from RFC 3526, because
+// the web client has no elliptic curves without WebCrypto. The generator 2
+// generates the subgroup of prime order (p-1)/2. An attacker learns nothing
+// that allows offline guessing of the PIN, so every attempt tests only a
+// single PIN.
+const (
+	pakeInfo          string = "remote-touchpad pake v1"
+	pakeElementLength int    = 256
+	pinDigits         int    = 6
+)
+
+var (
+	pakePrime, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1"+
+		"29024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7EDEE386BFB5A899FA5"+
+		"AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F"+
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C"+
+		"32905E462E36CE3BE39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718"+
+		"3995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+	pakeOrder     = new(big.Int).Rsh(pakePrime, 1)
+	pakeGenerator = big.NewInt(2)
+	// Elements with unknown discrete logarithm, that blind the PIN
+	pakeM = hashToGroup("remote-touchpad pake M")
+	pakeN = hashToGroup("remote-touchpad pake N")
+)
+
+var (
+	errInvalidPAKEElement = errors.New("invalid PAKE element")
+	errPairingBusy        = errors.New("another device is pairing")
+)
+
+// hashToGroup maps the label to an element of the subgroup by squaring.
+func hashToGroup(label string) *big.Int {
+	var digest []byte
+	for i := byte(0); len(digest) < pakeElementLength+sha256.Size; i++ {
+		sum := sha256.Sum256(append([]byte(label), i))
+		digest = append(digest, sum[:]...)
+	}
+	x := new(big.Int).SetBytes(digest)
+	x.Mod(x, pakePrime)
+	return x.Exp(x, big.NewInt(2), pakePrime)
+}
+
+func pakePassword(pin string) *big.Int {
+	sum := sha256.Sum256([]byte(pin))
+	return new(big.Int).SetBytes(sum[:])
+}
+
+func encodePAKEElement(x *big.Int) string {
+	return base64.StdEncoding.EncodeToString(x.FillBytes(make([]byte, pakeElementLength)))
+}
+
+// decodePAKEElement rejects everything that isn't a member of the subgroup.
+func decodePAKEElement(message string) (*big.Int, error) {
+	data, err := base64.StdEncoding.DecodeString(message)
+	if err != nil || len(data) != pakeElementLength {
+		return nil, errInvalidPAKEElement
+	}
+	x := new(big.Int).SetBytes(data)
+	if x.Cmp(big.NewInt(1)) <= 0 || x.Cmp(new(big.Int).Sub(pakePrime, big.NewInt(1))) >= 0 ||
+		new(big.Int).Exp(x, pakeOrder, pakePrime).Cmp(big.NewInt(1)) != 0 {
+		return nil, errInvalidPAKEElement
+	}
+	return x, nil
+}
+
+// pakeKeys are derived from the transcript of the exchange. The secret
+// replaces the secret of the credential for the encryption of the connection
+// and the confirmation proves to the server that the client used the same
+// PIN.
+type pakeKeys struct {
+	secret       string
+	confirmation string
+}
+
+func derivePAKEKeys(clientElement, serverElement, sharedElement *big.Int, pin, challenge string) (pakeKeys, error) {
+	var transcript []byte
+	for _, x := range []*big.Int{clientElement, serverElement, sharedElement} {
+		transcript = append(transcript, x.FillBytes(make([]byte, pakeElementLength))...)
+	}
+	transcript = append(transcript, pin...)
+	keys, err := hkdf.Key(sha256.New, transcript, []byte(challenge), pakeInfo, 2*sha256.Size)
+	if err != nil {
+		return pakeKeys{}, err
+	}
+	return pakeKeys{
+		secret:       base64.StdEncoding.EncodeToString(keys[:sha256.Size]),
+		confirmation: base64.StdEncoding.EncodeToString(keys[sha256.Size:]),
+	}, nil
+}
+
+// pakeRespond answers the element X = g^x * M^w of the client with
+// Y = g^y * N^w and derives the keys from K = (X / M^w)^y.
+func pakeRespond(pin, challenge, message string) (string, pakeKeys, error) {
+	clientElement, err := decodePAKEElement(message)
+	if err != nil {
+		return "", pakeKeys{}, err
+	}
+	w := pakePassword(pin)
+	y, err := rand.Int(rand.Reader, pakeOrder)
+	if err != nil {
+		return "", pakeKeys{}, err
+	}
+	serverElement := new(big.Int).Exp(pakeGenerator, y, pakePrime)
+	serverElement.Mul(serverElement, new(big.Int).Exp(pakeN, w, pakePrime))
+	serverElement.Mod(serverElement, pakePrime)
+	// The inverse of M^w is M^(q-w), because the order of M is q
+	sharedElement := new(big.Int).Exp(pakeM, new(big.Int).Sub(pakeOrder, w), pakePrime)
+	sharedElement.Mul(sharedElement, clientElement)
+	sharedElement.Mod(sharedElement, pakePrime)
+	sharedElement.Exp(sharedElement, y, pakePrime)
+	keys, err := derivePAKEKeys(clientElement, serverElement, sharedElement, pin, challenge)
+	if err != nil {
+		return "", pakeKeys{}, err
+	}
+	return encodePAKEElement(serverElement), keys, nil
+}
+
+// pinPairing hands out the PINs for pairing. Every PIN is only valid for a
+// single attempt and only one attempt can run at a time.
+type pinPairing struct {
+	mutex    sync.Mutex
+	pin      string
+	busy     bool
+	announce func(pin string)
+}
+
+func newPINPairing(announce func(pin string)) *pinPairing {
+	p := &pinPairing{announce: announce}
+	p.renewLocked()
+	return p
+}
+
+func (p *pinPairing) renewLocked() {
+	n, err := rand.Int(rand.Reader, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(pinDigits)), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.pin = fmt.Sprintf("%0*d", pinDigits, n)
+	p.announce(p.pin)
+}
+
+// take returns the PIN for an attempt. It must be released afterwards.
+func (p *pinPairing) take() (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.busy {
+		return "", errPairingBusy
+	}
+	p.busy = true
+	return p.pin, nil
+}
+
+// release ends the attempt and replaces the PIN.
+func (p *pinPairing) release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.busy = false
+	p.renewLocked()
+}
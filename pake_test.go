@@ -0,0 +1,118 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+// pakeClient is the client side of the key exchange, as implemented by the
+// web client.
+type pakeClient struct {
+	pin     string
+	x       *big.Int
+	element *big.Int
+}
+
+func newPAKEClient(t *testing.T, pin string) *pakeClient {
+	t.Helper()
+	x, err := rand.Int(rand.Reader, pakeOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	element := new(big.Int).Exp(pakeGenerator, x, pakePrime)
+	element.Mul(element, new(big.Int).Exp(pakeM, pakePassword(pin), pakePrime))
+	element.Mod(element, pakePrime)
+	return &pakeClient{pin: pin, x: x, element: element}
+}
+
+func (c *pakeClient) finish(t *testing.T, challenge, message string) pakeKeys {
+	t.Helper()
+	serverElement, err := decodePAKEElement(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedElement := new(big.Int).Exp(pakeN, new(big.Int).Sub(pakeOrder, pakePassword(c.pin)), pakePrime)
+	sharedElement.Mul(sharedElement, serverElement)
+	sharedElement.Mod(sharedElement, pakePrime)
+	sharedElement.Exp(sharedElement, c.x, pakePrime)
+	keys, err := derivePAKEKeys(c.element, serverElement, sharedElement, c.pin, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestPAKE(t *testing.T) {
+	client := newPAKEClient(t, "123456")
+	element, serverKeys, err := pakeRespond("123456", "challenge", encodePAKEElement(client.element))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientKeys := client.finish(t, "challenge", element); clientKeys != serverKeys {
+		t.Fatalf("keys differ: %#v %#v", clientKeys, serverKeys)
+	}
+
+	client = newPAKEClient(t, "123457")
+	element, serverKeys, err = pakeRespond("123456", "challenge", encodePAKEElement(client.element))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientKeys := client.finish(t, "challenge", element); clientKeys.confirmation == serverKeys.confirmation ||
+		clientKeys.secret == serverKeys.secret {
+		t.Fatal("keys match with wrong PIN")
+	}
+}
+
+func TestInvalidPAKEElement(t *testing.T) {
+	// 11 is a quadratic non-residue and not a member of the subgroup
+	for _, element := range []*big.Int{
+		big.NewInt(0), big.NewInt(1), big.NewInt(11), new(big.Int).Sub(pakePrime, big.NewInt(1)), pakePrime,
+	} {
+		if _, _, err := pakeRespond("123456", "challenge", encodePAKEElement(element)); err != errInvalidPAKEElement {
+			t.Errorf("%v: unexpected error: %v", element, err)
+		}
+	}
+	if _, _, err := pakeRespond("123456", "challenge", base64.StdEncoding.EncodeToString([]byte{2})); err != errInvalidPAKEElement {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPINPairingSingleAttempt(t *testing.T) {
+	var pins []string
+	p := newPINPairing(func(pin string) { pins = append(pins, pin) })
+	pin, err := p.take()
+	if err != nil || len(pin) != pinDigits || pin != pins[0] {
+		t.Fatalf("unexpected PIN %#v (%v)", pin, err)
+	}
+	if _, err := p.take(); err != errPairingBusy {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.release()
+	if len(pins) != 2 {
+		t.Fatalf("PIN wasn't renewed: %v", pins)
+	}
+	if pin, err := p.take(); err != nil || pin != pins[1] {
+		t.Fatalf("unexpected PIN %#v (%v)", pin, err)
+	}
+}
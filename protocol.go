@@ -0,0 +1,402 @@
+/*
+ *    Copyright (c) 2018-2019, 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/unrud/remote-touchpad/inputcontrol"
+)
+
+// Protocol versions:
+//
+//  1. Single-letter text commands ("m", "s", "S", "b", "k", "t"). Clients
+//     answer the challenge with the bare response and receive the config as
+//     plain JSON.
+//  2. Clients answer the challenge with a JSON hello message that lists the
+//     supported versions and features and names the authentication scheme.
+//     All further messages are JSON objects with a "type" field. Problems
+//     are reported to the client with error messages; the connection is
+//     only closed for fatal errors.
+const (
+	protocolVersionLegacy int = 1
+	protocolVersion       int = 2
+)
+
+var protocolVersions = []int{protocolVersionLegacy, protocolVersion}
+
+const (
+	// Clients can send multiple commands in a single batch message.
+	featureBatch string = "batch"
+	// The server sends ping messages that clients answer with pong messages.
+	// Connections are closed when no message is received within the timeout.
+	featureHeartbeat string = "heartbeat"
+	// The server issues a session token that clients can use to reattach to
+	// the session after the connection was lost.
+	featureResume string = "resume"
+	// Clients can pair with the server to receive a device token, that is
+	// used for authentication instead of the secret.
+	featurePairing string = "pairing"
+	// All messages after the server hello are encrypted and authenticated
+	// with keys derived from the secret and the challenge.
+	featureEncryption string = "encryption"
+	// Pings carry a timestamp that is echoed in the pong. The server reports
+	// the round-trip time and the duration of controller calls with stats
+	// messages. Requires the heartbeat feature.
+	featureLatency string = "latency"
+	// The server adapts the update rate of the client to the backpressure
+	// with rate messages.
+	featureAdaptiveRate string = "adaptive-rate"
+)
+
+// Optional protocol features supported by the server.
+var protocolFeatures = []string{
+	featureBatch, featureHeartbeat, featureResume, featurePairing, featureEncryption, featureLatency,
+	featureAdaptiveRate,
+}
+
+const maxBatchLength int = 1000
+
+const (
+	messageHello    string = "hello"
+	messageConfig   string = "config"
+	messageMove     string = "move"
+	messageScroll   string = "scroll"
+	messageButton   string = "button"
+	messageKey      string = "key"
+	messageText     string = "text"
+	messageError    string = "error"
+	messageBatch    string = "batch"
+	messagePing     string = "ping"
+	messagePong     string = "pong"
+	messagePair     string = "pair"
+	messagePaired   string = "paired"
+	messagePAKE     string = "pake"
+	messageSettings string = "settings"
+	messageStats    string = "stats"
+	messageRate     string = "rate"
+)
+
+const (
+	errorInvalidHello       string = "invalid-hello"
+	errorUnauthorized       string = "unauthorized"
+	errorUnsupportedVersion string = "unsupported-version"
+	errorInvalidCommand     string = "invalid-command"
+	errorUnsupportedInput   string = "unsupported-input"
+	errorController         string = "controller"
+	errorBusy               string = "busy"
+	errorTakenOver          string = "taken-over"
+	errorForbidden          string = "forbidden"
+	errorLockedOut          string = "locked-out"
+	errorPairing            string = "pairing"
+	errorDecryption         string = "decryption"
+	errorEncryptionRequired string = "encryption-required"
+	errorSettings           string = "settings"
+)
+
+type clientHello struct {
+	Type     string   `json:"type"`
+	Auth     int      `json:"auth"`
+	Response string   `json:"response"`
+	Versions []int    `json:"versions"`
+	Features []string `json:"features"`
+	Resume   string   `json:"resume,omitempty"`
+	Device   string   `json:"device,omitempty"`
+	// Element of the key exchange for PIN pairing
+	PAKE string `json:"pake,omitempty"`
+}
+
+type serverHello struct {
+	Type     string   `json:"type"`
+	Version  int      `json:"version"`
+	Versions []int    `json:"versions,omitempty"`
+	Features []string `json:"features"`
+
+	// Heartbeat settings in milliseconds
+	PingInterval int64 `json:"pingInterval,omitempty"`
+	PingTimeout  int64 `json:"pingTimeout,omitempty"`
+
+	Session       string `json:"session,omitempty"`
+	Resumed       bool   `json:"resumed,omitempty"`
+	ResumeTimeout int64  `json:"resumeTimeout,omitempty"`
+
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// pingMessage is used for pings and pongs. Pongs echo the time of the ping.
+type pingMessage struct {
+	Type string  `json:"type"`
+	Time float64 `json:"time,omitempty"`
+}
+
+// rateMessage replaces the update rate of the config until the next config.
+type rateMessage struct {
+	Type       string `json:"type"`
+	UpdateRate uint   `json:"updateRate"`
+}
+
+// statsMessage reports the moving averages of the latency in milliseconds.
+type statsMessage struct {
+	Type           string  `json:"type"`
+	RoundTripTime  float64 `json:"roundTripTime"`
+	ControllerTime float64 `json:"controllerTime"`
+}
+
+type configMessage struct {
+	Type string `json:"type"`
+	config
+}
+
+type pairedMessage struct {
+	Type   string `json:"type"`
+	Device string `json:"device"`
+	Token  string `json:"token"`
+}
+
+// pakeMessage continues the key exchange for PIN pairing. The server sends its
+// element and the client answers with the confirmation.
+type pakeMessage struct {
+	Type         string `json:"type"`
+	Element      string `json:"element,omitempty"`
+	Confirmation string `json:"confirmation,omitempty"`
+}
+
+type errorMessage struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Fatal   bool   `json:"fatal"`
+}
+
+type command struct {
+	Type   string `json:"type"`
+	X      int    `json:"x,omitempty"`
+	Y      int    `json:"y,omitempty"`
+	Finish bool   `json:"finish,omitempty"`
+	// Scroll deltas are in the direction of the gesture and the server
+	// applies the scroll direction of the config. Scrolling with the mouse
+	// wheel uses the direction of the mouse.
+	Wheel  bool   `json:"wheel,omitempty"`
+	Button int    `json:"button,omitempty"`
+	Press  bool   `json:"press,omitempty"`
+	Key    int    `json:"key,omitempty"`
+	Text   string `json:"text,omitempty"`
+	Name   string `json:"name,omitempty"`
+	// Changed values of the config. The values of keys that are null and
+	// with reset all values return to the defaults.
+	Config json.RawMessage `json:"config,omitempty"`
+	Reset  bool            `json:"reset,omitempty"`
+	// Timestamp of pings and pongs
+	Time float64 `json:"time,omitempty"`
+
+	Commands []command `json:"commands,omitempty"`
+}
+
+var errNoCommonVersion = errors.New("no common protocol version")
+
+// parseClientHello parses the answer to the authentication challenge.
+// Legacy clients send the bare response.
+func parseClientHello(message string) (clientHello, error) {
+	if !strings.HasPrefix(message, "{") {
+		return clientHello{
+			Type:     messageHello,
+			Auth:     authSchemeLegacy,
+			Response: message,
+			Versions: []int{protocolVersionLegacy},
+		}, nil
+	}
+	var hello clientHello
+	if err := json.Unmarshal([]byte(message), &hello); err != nil {
+		return hello, err
+	}
+	if hello.Type != messageHello {
+		return hello, errors.New("expected hello message")
+	}
+	if hello.Auth == 0 {
+		hello.Auth = authSchemeLegacy
+	}
+	return hello, nil
+}
+
+func parsePAKEMessage(message string) (pakeMessage, error) {
+	var pake pakeMessage
+	if err := json.Unmarshal([]byte(message), &pake); err != nil {
+		return pake, err
+	}
+	if pake.Type != messagePAKE {
+		return pake, errors.New("expected pake message")
+	}
+	return pake, nil
+}
+
+// negotiateProtocol selects the highest protocol version and the optional
+// features supported by both sides.
+func negotiateProtocol(hello clientHello) (int, []string, error) {
+	version := 0
+	for _, v := range hello.Versions {
+		if v > version && slices.Contains(protocolVersions, v) {
+			version = v
+		}
+	}
+	if version == 0 {
+		return 0, nil, errNoCommonVersion
+	}
+	features := []string{}
+	if version >= protocolVersion {
+		for _, feature := range protocolFeatures {
+			if slices.Contains(hello.Features, feature) {
+				features = append(features, feature)
+			}
+		}
+	}
+	return version, features, nil
+}
+
+func parseLegacyCommand(message string) (command, error) {
+	if len(message) == 0 {
+		return command{}, errors.New("empty command")
+	}
+	if message == "S" {
+		return command{Type: messageScroll, Finish: true}, nil
+	}
+	if message[0] == 't' {
+		cmd := command{Type: messageText, Text: message[1:]}
+		return cmd, cmd.validate()
+	}
+	arguments := strings.Split(message[1:], ";")
+	if message[0] == 'k' && len(arguments) != 1 ||
+		message[0] != 'k' && len(arguments) != 2 {
+		return command{}, errors.New("wrong number of arguments")
+	}
+	x, err := strconv.ParseInt(arguments[0], 10, 32)
+	if err != nil {
+		return command{}, err
+	}
+	if message[0] == 'k' {
+		return command{Type: messageKey, Key: int(x)}, nil
+	}
+	y, err := strconv.ParseInt(arguments[1], 10, 32)
+	if err != nil {
+		return command{}, err
+	}
+	switch message[0] {
+	case 'm':
+		return command{Type: messageMove, X: int(x), Y: int(y)}, nil
+	case 's':
+		return command{Type: messageScroll, X: int(x), Y: int(y)}, nil
+	case 'S':
+		return command{Type: messageScroll, X: int(x), Y: int(y), Finish: true}, nil
+	case 'b':
+		return command{Type: messageButton, Button: int(x), Press: y != 0}, nil
+	}
+	return command{}, errors.New("unsupported command")
+}
+
+func parseCommand(message string) (command, error) {
+	var cmd command
+	if err := json.Unmarshal([]byte(message), &cmd); err != nil {
+		return cmd, err
+	}
+	return cmd, cmd.validate()
+}
+
+func (cmd command) validate() error {
+	switch cmd.Type {
+	case messageMove, messageScroll, messageButton, messageKey, messagePing, messagePong, messageSettings:
+		return nil
+	case messageBatch:
+		if len(cmd.Commands) > maxBatchLength {
+			return errors.New("batch too long")
+		}
+		for _, subCmd := range cmd.Commands {
+			if subCmd.Type == messageBatch || subCmd.Type == messagePing ||
+				subCmd.Type == messagePong || subCmd.Type == messagePair ||
+				subCmd.Type == messageSettings {
+				return fmt.Errorf("unsupported command in batch: %#v", subCmd.Type)
+			}
+			if err := subCmd.validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	case messageText:
+		if !utf8.ValidString(cmd.Text) {
+			return errors.New("invalid utf-8")
+		}
+		return nil
+	case messagePair:
+		if !utf8.ValidString(cmd.Name) {
+			return errors.New("invalid utf-8")
+		}
+		if utf8.RuneCountInString(cmd.Name) > maxDeviceName {
+			return errors.New("device name too long")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported command: %#v", cmd.Type)
+}
+
+// coalesceCommands merges consecutive pointer movements, to reduce the number
+// of controller calls.
+func coalesceCommands(cmds []command) []command {
+	result := make([]command, 0, len(cmds))
+	for _, cmd := range cmds {
+		if last := len(result) - 1; last >= 0 &&
+			cmd.Type == messageMove && result[last].Type == messageMove {
+			result[last].X += cmd.X
+			result[last].Y += cmd.Y
+			continue
+		}
+		result = append(result, cmd)
+	}
+	return result
+}
+
+func processCommand(controller inputcontrol.Controller, cmd command) error {
+	switch cmd.Type {
+	case messageMove:
+		return controller.PointerMove(cmd.X, cmd.Y)
+	case messageScroll:
+		return controller.PointerScroll(cmd.X, cmd.Y, cmd.Finish)
+	case messageButton:
+		if cmd.Button < 0 || cmd.Button >= int(inputcontrol.PointerButtonLimit) {
+			return &inputcontrol.UnsupportedInputError{
+				Err: fmt.Errorf("unsupported pointer button: %#v", cmd.Button),
+			}
+		}
+		return controller.PointerButton(inputcontrol.PointerButton(cmd.Button), cmd.Press)
+	case messageKey:
+		if cmd.Key < 0 || cmd.Key >= int(inputcontrol.KeyLimit) {
+			return &inputcontrol.UnsupportedInputError{
+				Err: fmt.Errorf("unsupported key: %#v", cmd.Key),
+			}
+		}
+		return controller.KeyboardKey(inputcontrol.Key(cmd.Key))
+	case messageText:
+		return controller.KeyboardText(cmd.Text)
+	}
+	return errors.New("unsupported command")
+}
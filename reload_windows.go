@@ -0,0 +1,49 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+const configFilePollInterval time.Duration = 2 * time.Second
+
+// watchReload requests a reload of the configuration when the configuration
+// file changes. Windows has no SIGHUP.
+func watchReload(configFile string, reloads chan<- struct{}) {
+	if configFile == "" {
+		return
+	}
+	modTime := func() time.Time {
+		info, err := os.Stat(configFile)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	lastModTime := modTime()
+	for range time.Tick(configFilePollInterval) {
+		if t := modTime(); !t.Equal(lastModTime) {
+			lastModTime = t
+			reloads <- struct{}{}
+		}
+	}
+}
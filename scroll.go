@@ -0,0 +1,110 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unrud/remote-touchpad/inputcontrol"
+)
+
+const (
+	scrollHorizontal string = "horizontal"
+	scrollVertical   string = "vertical"
+)
+
+type scrollAxes struct {
+	horizontal bool
+	vertical   bool
+}
+
+// parseScrollAxes parses AXIS[,AXIS].
+func parseScrollAxes(value string) (scrollAxes, error) {
+	var axes scrollAxes
+	for _, axis := range strings.Split(value, ",") {
+		switch strings.TrimSpace(axis) {
+		case scrollHorizontal:
+			axes.horizontal = true
+		case scrollVertical:
+			axes.vertical = true
+		default:
+			return scrollAxes{}, fmt.Errorf("invalid axis %#v", axis)
+		}
+	}
+	return axes, nil
+}
+
+// invertingController inverts the scroll direction of the wrapped controller,
+// for backends that scroll in the opposite direction of the others.
+type invertingController struct {
+	inputcontrol.Controller
+	axes scrollAxes
+}
+
+func (p *invertingController) PointerScroll(deltaHorizontal, deltaVertical int, finish bool) error {
+	if p.axes.horizontal {
+		deltaHorizontal = -deltaHorizontal
+	}
+	if p.axes.vertical {
+		deltaVertical = -deltaVertical
+	}
+	return p.Controller.PointerScroll(deltaHorizontal, deltaVertical, finish)
+}
+
+// scrollDirection applies natural scrolling of the config to the deltas of a
+// scroll gesture or of the mouse wheel.
+func (c config) scrollDirection(deltaHorizontal, deltaVertical int, wheel bool) (int, int) {
+	if wheel && c.MouseNaturalScrolling || !wheel && c.NaturalScrolling {
+		return -deltaHorizontal, -deltaVertical
+	}
+	return deltaHorizontal, deltaVertical
+}
+
+// scrollAxisLock suppresses the minor axis of scroll gestures. The first
+// movement of a gesture selects the axis, that is kept until the gesture
+// finishes.
+type scrollAxisLock struct {
+	locked     bool
+	horizontal bool
+}
+
+func (l *scrollAxisLock) filter(deltaHorizontal, deltaVertical int, finish bool) (int, int) {
+	if !l.locked && (deltaHorizontal != 0 || deltaVertical != 0) {
+		l.locked = true
+		l.horizontal = abs(deltaHorizontal) > abs(deltaVertical)
+	}
+	if l.locked && l.horizontal {
+		deltaVertical = 0
+	} else if l.locked {
+		deltaHorizontal = 0
+	}
+	if finish {
+		l.locked = false
+	}
+	return deltaHorizontal, deltaVertical
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
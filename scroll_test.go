@@ -0,0 +1,60 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScrollAxisLock(t *testing.T) {
+	var lock scrollAxisLock
+	var results []string
+	for _, delta := range [][3]int{{1, 5, 0}, {3, 2, 0}, {0, 0, 1}, {4, -2, 0}, {1, 3, 1}, {0, 2, 0}} {
+		x, y := lock.filter(delta[0], delta[1], delta[2] != 0)
+		results = append(results, fmt.Sprint(x, y))
+	}
+	if actual := fmt.Sprint(results); actual != "[0 5 0 2 0 0 4 0 1 0 0 2]" {
+		t.Errorf("unexpected deltas: %s", actual)
+	}
+}
+
+func TestInvertingController(t *testing.T) {
+	for value, expected := range map[string]string{
+		"horizontal":          "scroll -1 2 true",
+		"vertical":            "scroll 1 -2 true",
+		"vertical,horizontal": "scroll -1 -2 true",
+	} {
+		axes, err := parseScrollAxes(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := &recordingController{}
+		controller := &invertingController{Controller: recorder, axes: axes}
+		controller.PointerScroll(1, 2, true)
+		controller.PointerMove(1, 2)
+		if actual := fmt.Sprint(recorder.Calls()); actual != "["+expected+" move 1 2]" {
+			t.Errorf("%s: unexpected calls: %s", value, actual)
+		}
+	}
+	if _, err := parseScrollAxes("diagonal"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,745 @@
+/*
+ *    Copyright (c) 2018-2019, 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/unrud/remote-touchpad/inputcontrol"
+	"golang.org/x/net/websocket"
+)
+
+type server struct {
+	controllerName string
+	configMutex    sync.Mutex
+	config         config
+	// Number of the last config sent to a client, protected by configMutex
+	configVersion uint64
+	// Config of users, protected by configMutex
+	userConfigs map[string]configOverrides
+	credentials []*credential
+	lockout     *authLockout
+	devices     *deviceStore
+	// Set when pairing with a PIN is enabled
+	pins               *pinPairing
+	clientCertificates []clientCertificate
+	challengeTimeout   time.Duration
+	legacyAuth         bool
+	// Reject clients without encryption, unless TLS is used
+	requireEncryption  bool
+	pingInterval       time.Duration
+	pingTimeout        time.Duration
+	adaptiveUpdateRate bool
+	minUpdateRate      uint
+	maxUpdateRate      uint
+	sessions           *sessionRegistry
+}
+
+type client struct {
+	ws       *websocket.Conn
+	version  int
+	features []string
+	timeout  time.Duration
+	session  *session
+	// The client received the initial config, protected by configMutex
+	configured bool
+	// The last config sent to the client, set with the sendMutex held
+	config        atomic.Pointer[config]
+	configVersion uint64
+	scrollLock    scrollAxisLock
+	// Reference for the timestamps of pings
+	started time.Time
+	latency latencyStats
+	// Time that receive waited for the last message
+	waited     time.Duration
+	updateRate updateRateController
+	// The config that updateRate was reset with
+	rateConfig *config
+
+	sendMutex sync.Mutex
+	// Set after the server hello with the encryption feature
+	cipher *messageCipher
+}
+
+func (c *client) send(v any) error {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	return c.sendLocked(v)
+}
+
+func (c *client) sendLocked(v any) error {
+	if c.timeout > 0 {
+		c.ws.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	if c.cipher == nil {
+		return websocket.JSON.Send(c.ws, v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return websocket.Message.Send(c.ws, c.cipher.seal(data))
+}
+
+// sendHello sends the server hello. All further messages are encrypted, if
+// the cipher is set.
+func (c *client) sendHello(hello serverHello, cipher *messageCipher) error {
+	if err := c.send(hello); err != nil {
+		return err
+	}
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	c.cipher = cipher
+	return nil
+}
+
+// sendConfig sends the config, unless the client already received a newer
+// one. Configs are sent after the configMutex was released and can overtake
+// each other.
+func (c *client) sendConfig(config config, version uint64) error {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	if version <= c.configVersion {
+		return nil
+	}
+	c.configVersion = version
+	c.config.Store(&config)
+	if c.version == protocolVersionLegacy {
+		return c.sendLocked(config)
+	}
+	return c.sendLocked(configMessage{Type: messageConfig, config: config})
+}
+
+// sendRate sends the update rate, unless the client received a newer config
+// in the meantime, that resets the rate.
+func (c *client) sendRate(rate uint, config *config) error {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	if c.config.Load() != config {
+		return nil
+	}
+	return c.sendLocked(rateMessage{Type: messageRate, UpdateRate: rate})
+}
+
+// receive waits for the next message. With the heartbeat feature, the
+// connection fails when the client stays silent for longer than the timeout.
+func (c *client) receive(message *string) error {
+	if c.timeout > 0 && (c.version == 0 || c.hasFeature(featureHeartbeat)) {
+		c.ws.SetReadDeadline(time.Now().Add(c.timeout))
+	} else {
+		c.ws.SetReadDeadline(time.Time{})
+	}
+	start := time.Now()
+	if err := websocket.Message.Receive(c.ws, message); err != nil {
+		return err
+	}
+	c.waited = time.Since(start)
+	if c.cipher != nil {
+		plaintext, err := c.cipher.open(*message)
+		if err != nil {
+			c.sendError(errorDecryption, err, true)
+			return err
+		}
+		*message = string(plaintext)
+	}
+	return nil
+}
+
+// heartbeat sends pings until done is closed. Clients without the heartbeat
+// feature receive WebSocket ping frames, which keep the connection alive but
+// can't be used to detect dead connections, because the pong frames are
+// handled internally by the websocket package.
+func (c *client) heartbeat(interval time.Duration, done <-chan struct{}) {
+	if !c.hasFeature(featureHeartbeat) {
+		c.ws.PayloadType = websocket.PingFrame
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		var err error
+		if c.hasFeature(featureLatency) {
+			err = c.send(pingMessage{Type: messagePing, Time: durationMilliseconds(time.Since(c.started))})
+		} else if c.hasFeature(featureHeartbeat) {
+			err = c.send(pingMessage{Type: messagePing})
+		} else {
+			if c.timeout > 0 {
+				c.ws.SetWriteDeadline(time.Now().Add(c.timeout))
+			}
+			_, err = c.ws.Write(nil)
+		}
+		if err != nil {
+			c.ws.Close()
+			return
+		}
+	}
+}
+
+func (c *client) logLatency() {
+	if c.latency.roundTrip.samples == 0 && c.latency.controller.samples == 0 {
+		return
+	}
+	log.Printf("Client %s latency: round-trip time %v, controller %v", c.ws.Request().RemoteAddr,
+		c.latency.roundTrip.value.Round(time.Microsecond), c.latency.controller.value.Round(time.Microsecond))
+}
+
+func (c *client) hasFeature(feature string) bool {
+	return slices.Contains(c.features, feature)
+}
+
+func (c *client) parseCommand(message string) (command, error) {
+	if c.version == protocolVersionLegacy {
+		return parseLegacyCommand(message)
+	}
+	return parseCommand(message)
+}
+
+// sendError informs the client about a problem. Legacy clients can't be
+// informed and all errors are fatal for them. The return value reports whether
+// the connection can be kept open.
+func (c *client) sendError(code string, err error, fatal bool) bool {
+	if c.version == protocolVersionLegacy {
+		return false
+	}
+	if sendErr := c.send(errorMessage{
+		Type: messageError, Code: code, Message: err.Error(), Fatal: fatal,
+	}); sendErr != nil {
+		return false
+	}
+	return !fatal
+}
+
+func (s *server) handleWebSocket(ws *websocket.Conn) {
+	var message string
+	c := &client{ws: ws, timeout: s.pingTimeout, started: time.Now()}
+	challenge := newChallenge(s.challengeTimeout)
+	websocket.Message.Send(ws, challenge.message)
+	if err := c.receive(&message); err != nil {
+		return
+	}
+	// Errors before negotiation are reported with the newest protocol
+	// version, unless the client is known to be a legacy client.
+	c.version = protocolVersion
+	hello, err := parseClientHello(message)
+	if err != nil {
+		c.sendError(errorInvalidHello, err, true)
+		return
+	}
+	if slices.Equal(hello.Versions, []int{protocolVersionLegacy}) {
+		c.version = protocolVersionLegacy
+	}
+	if hello.Auth == authSchemeLegacy && !s.legacyAuth {
+		log.Printf("Rejected client %s: legacy authentication disabled", ws.Request().RemoteAddr)
+		c.sendError(errorUnauthorized, errUnsupportedScheme, true)
+		return
+	}
+	certCred, subject := certificateCredential(ws.Request().TLS, s.clientCertificates)
+	if certCred == nil && subject != "" {
+		log.Printf("Client %s presented unknown certificate %s", ws.Request().RemoteAddr, subject)
+	}
+	var cred *credential
+	switch {
+	case hello.Auth == authSchemePIN:
+		cred, err = s.authenticatePIN(c, challenge, hello)
+	case certCred != nil:
+		if err = challenge.use(); err == nil {
+			cred = certCred
+			log.Printf("Client %s authenticated with certificate %s", ws.Request().RemoteAddr, subject)
+		}
+	case hello.Auth == authSchemeCertificate:
+		if err = challenge.use(); err == nil {
+			err = errNoClientCertificate
+		}
+	default:
+		err = s.lockout.attempt(ws.Request().RemoteAddr, func() (err error) {
+			credentials, err := s.helloCredentials(hello)
+			if err != nil {
+				return err
+			}
+			cred, err = challenge.authenticate(credentials, hello.Auth, hello.Response,
+				slices.Contains(hello.Features, featureEncryption))
+			return err
+		})
+	}
+	if err != nil {
+		var lockedOutErr *lockedOutError
+		if errors.As(err, &lockedOutErr) {
+			c.sendError(errorLockedOut, err, true)
+		} else {
+			c.sendError(errorUnauthorized, err, true)
+		}
+		return
+	}
+	c.version, c.features, err = negotiateProtocol(hello)
+	c.features = slices.DeleteFunc(c.features, func(feature string) bool {
+		return feature == featureHeartbeat && s.pingInterval <= 0 ||
+			feature == featurePairing && s.devices == nil ||
+			feature == featureAdaptiveRate && !s.adaptiveUpdateRate ||
+			// Client certificates imply TLS and there is no secret
+			feature == featureEncryption && cred.secret == ""
+	})
+	c.features = slices.DeleteFunc(c.features, func(feature string) bool {
+		return feature == featureLatency && !c.hasFeature(featureHeartbeat)
+	})
+	if err != nil {
+		c.send(serverHello{
+			Type: messageHello, Versions: protocolVersions, Features: []string{},
+		})
+		c.version = protocolVersion
+		c.sendError(errorUnsupportedVersion, err, true)
+		return
+	}
+	if s.requireEncryption && !c.hasFeature(featureEncryption) && ws.Request().TLS == nil {
+		log.Printf("Rejected client %s: encryption required", ws.Request().RemoteAddr)
+		c.sendError(errorEncryptionRequired, errors.New("encryption required"), true)
+		return
+	}
+	var cipher *messageCipher
+	if c.hasFeature(featureEncryption) {
+		if cipher, err = newMessageCipher(cred.secret, challenge.message, true); err != nil {
+			log.Print(err)
+			return
+		}
+	}
+	sess, resumed, err := s.sessions.attach(c, cred, hello.Resume)
+	if err != nil {
+		log.Printf("Rejected client %s: %v", ws.Request().RemoteAddr, err)
+		c.sendError(errorBusy, err, true)
+		return
+	}
+	defer s.sessions.detach(sess, c)
+	c.session = sess
+	c.updateRate = updateRateController{min: s.minUpdateRate, max: s.maxUpdateRate}
+	defer c.logLatency()
+	if resumed {
+		log.Printf("Client %s resumed session", ws.Request().RemoteAddr)
+	}
+	if cred.user != "" {
+		log.Printf("Client %s started session as user %s", ws.Request().RemoteAddr, cred.user)
+		defer log.Printf("Client %s ended session as user %s", ws.Request().RemoteAddr, cred.user)
+	}
+	if cred.device != "" {
+		log.Printf("Client %s authenticated as device %s", ws.Request().RemoteAddr, cred.device)
+		if err := s.devices.seen(cred.device); err != nil {
+			log.Printf("Failed to update device: %v", err)
+		}
+		if !resumed {
+			s.loadSettings(sess)
+		}
+	}
+	if c.version != protocolVersionLegacy {
+		hello := serverHello{
+			Type: messageHello, Version: c.version, Features: c.features,
+			Scopes: sess.credential.scopes,
+		}
+		if c.hasFeature(featureHeartbeat) {
+			hello.PingInterval = s.pingInterval.Milliseconds()
+			hello.PingTimeout = s.pingTimeout.Milliseconds()
+		}
+		if sess.token != "" {
+			hello.Session = sess.token
+			hello.Resumed = resumed
+			hello.ResumeTimeout = s.sessions.timeout.Milliseconds()
+		}
+		if err := c.sendHello(hello, cipher); err != nil {
+			return
+		}
+	}
+	if err := s.sendInitialConfig(c); err != nil {
+		return
+	}
+	if s.pingInterval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go c.heartbeat(s.pingInterval, done)
+	}
+	for {
+		if err := c.receive(&message); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Printf("Client %s timed out", ws.Request().RemoteAddr)
+			}
+			return
+		}
+		if !s.handleMessage(c, message) {
+			return
+		}
+		// Long sessions are summarized periodically and when they end
+		if c.latency.logDue(time.Now()) {
+			c.logLatency()
+		}
+	}
+}
+
+// clientConfigLocked returns the config with the values of the user of the
+// client and the settings of its session.
+func (s *server) clientConfigLocked(c *client) config {
+	userConfig := s.userConfigs[c.session.credential.user].apply(s.config)
+	sessionConfig, err := applySettings(userConfig, c.session.settings)
+	if err != nil {
+		// Invalid settings, e.g. from an edited devices file, are ignored
+		return userConfig
+	}
+	return sessionConfig
+}
+
+// applySettings replaces the values of the config with the settings. The keys
+// are the JSON names of the config.
+func applySettings(c config, settings map[string]json.RawMessage) (config, error) {
+	if len(settings) == 0 {
+		return c, nil
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return c, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return c, err
+	}
+	return c, c.validate()
+}
+
+// loadSettings restores the settings of paired devices in new sessions.
+func (s *server) loadSettings(sess *session) {
+	settings, err := s.devices.settings(sess.credential.device)
+	if err != nil {
+		log.Printf("Failed to load settings of device: %v", err)
+		return
+	}
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	sess.settings = settings
+}
+
+// configUpdate is a config for a client, that is sent after the configMutex
+// was released, so that slow clients don't block the others.
+type configUpdate struct {
+	client  *client
+	config  config
+	version uint64
+}
+
+func (s *server) configUpdateLocked(c *client) configUpdate {
+	s.configVersion++
+	return configUpdate{client: c, config: s.clientConfigLocked(c), version: s.configVersion}
+}
+
+func sendConfigUpdates(updates []configUpdate) {
+	for _, u := range updates {
+		if err := u.client.sendConfig(u.config, u.version); err != nil {
+			u.client.ws.Close()
+		}
+	}
+}
+
+func (s *server) sendInitialConfig(c *client) error {
+	s.configMutex.Lock()
+	c.configured = true
+	u := s.configUpdateLocked(c)
+	s.configMutex.Unlock()
+	return c.sendConfig(u.config, u.version)
+}
+
+// updateConfig replaces the config and sends it to all connected clients.
+func (s *server) updateConfig(config config, userConfigs map[string]configOverrides) {
+	var updates []configUpdate
+	s.configMutex.Lock()
+	s.config = config
+	s.userConfigs = userConfigs
+	for _, c := range s.sessions.clients() {
+		if c.configured {
+			updates = append(updates, s.configUpdateLocked(c))
+		}
+	}
+	s.configMutex.Unlock()
+	sendConfigUpdates(updates)
+}
+
+// helloCredentials returns the credentials that the client can authenticate
+// with. Paired devices authenticate with their device token.
+func (s *server) helloCredentials(hello clientHello) ([]*credential, error) {
+	if hello.Device == "" {
+		return s.credentials, nil
+	}
+	if s.devices == nil || hello.Auth == authSchemeLegacy {
+		return nil, errAuthentication
+	}
+	cred, err := s.devices.credential(hello.Device)
+	if errors.Is(err, errUnknownDevice) {
+		return nil, errAuthentication
+	} else if err != nil {
+		log.Printf("Failed to load devices: %v", err)
+		return nil, err
+	}
+	return []*credential{cred}, nil
+}
+
+// authenticatePIN runs the key exchange with the current PIN. The credential
+// grants full access and its secret is the exchanged key, which encrypts the
+// connection. Clients are expected to pair afterwards.
+func (s *server) authenticatePIN(c *client, challenge *challenge, hello clientHello) (*credential, error) {
+	if s.pins == nil {
+		return nil, errUnsupportedScheme
+	}
+	if !slices.Contains(hello.Features, featureEncryption) {
+		return nil, errors.New("PIN pairing requires encryption")
+	}
+	remoteAddr := c.ws.Request().RemoteAddr
+	var keys pakeKeys
+	// Locked out clients must not use up PINs
+	if err := s.lockout.attempt(remoteAddr, func() error {
+		if err := challenge.use(); err != nil {
+			return err
+		}
+		pin, err := s.pins.take()
+		if err != nil {
+			return err
+		}
+		defer s.pins.release()
+		// Every failure of the exchange counts, including timeouts, so that
+		// clients can't try PINs by aborting it
+		keys, err = exchangePIN(c, challenge, hello, pin)
+		if err != nil && !errors.Is(err, errAuthentication) {
+			return fmt.Errorf("%w: %w", errAuthentication, err)
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	log.Printf("Client %s authenticated with PIN", remoteAddr)
+	return &credential{secret: keys.secret, scopes: allScopes}, nil
+}
+
+func exchangePIN(c *client, challenge *challenge, hello clientHello, pin string) (pakeKeys, error) {
+	element, keys, err := pakeRespond(pin, challenge.message, hello.PAKE)
+	if err != nil {
+		return pakeKeys{}, err
+	}
+	if err := c.send(pakeMessage{Type: messagePAKE, Element: element}); err != nil {
+		return pakeKeys{}, err
+	}
+	// The PIN is blocked until the client answers, which happens without
+	// user interaction
+	deadline := time.Now().Add(pinExchangeTimeout)
+	if challenge.expiry.Before(deadline) {
+		deadline = challenge.expiry
+	}
+	c.ws.SetReadDeadline(deadline)
+	var message string
+	if err := websocket.Message.Receive(c.ws, &message); err != nil {
+		return pakeKeys{}, err
+	}
+	confirmation, err := parsePAKEMessage(message)
+	if err != nil {
+		return pakeKeys{}, err
+	}
+	if !hmac.Equal([]byte(confirmation.Confirmation), []byte(keys.confirmation)) {
+		return pakeKeys{}, errAuthentication
+	}
+	return keys, nil
+}
+
+// handleMessage processes a message from an authenticated client. The return
+// value reports whether the connection can be kept open.
+func (s *server) handleMessage(c *client, message string) bool {
+	cmd, err := c.parseCommand(message)
+	if err == nil && cmd.Type == messageBatch && !c.hasFeature(featureBatch) {
+		err = errors.New("batch feature not negotiated")
+	}
+	if err == nil && cmd.Type == messagePair && !c.hasFeature(featurePairing) {
+		err = errors.New("pairing feature not negotiated")
+	}
+	if err != nil {
+		log.Printf("Invalid command: %v", err)
+		return c.sendError(errorInvalidCommand, err, false)
+	}
+	if !c.session.credential.allows(cmd) {
+		return c.sendError(errorForbidden, fmt.Errorf("%s not permitted", cmd.Type), false)
+	}
+	switch cmd.Type {
+	case messagePing:
+		return c.send(pingMessage{Type: messagePong, Time: cmd.Time}) == nil
+	case messagePong:
+		return s.handlePong(c, cmd)
+	case messagePair:
+		return s.handlePair(c, cmd)
+	case messageSettings:
+		return s.handleSettings(c, cmd)
+	case messageBatch:
+		start := time.Now()
+		for _, subCmd := range coalesceCommands(cmd.Commands) {
+			if !s.handleCommand(c, subCmd) {
+				return false
+			}
+		}
+		return s.adaptUpdateRate(c, cmd, time.Since(start))
+	default:
+		start := time.Now()
+		return s.handleCommand(c, cmd) && s.adaptUpdateRate(c, cmd, time.Since(start))
+	}
+}
+
+// adaptUpdateRate sends the client a new update rate, when the handling of
+// updates shows that the rate is too high or can be raised.
+func (s *server) adaptUpdateRate(c *client, cmd command, handling time.Duration) bool {
+	// Only movements are sent with the update rate
+	if !c.hasFeature(featureAdaptiveRate) || cmd.Type != messageMove &&
+		cmd.Type != messageScroll && cmd.Type != messageBatch {
+		return true
+	}
+	config := c.config.Load()
+	now := time.Now()
+	// The client falls back to the update rate of every config
+	if config != c.rateConfig {
+		c.rateConfig = config
+		c.updateRate.reset(config.UpdateRate, now)
+	}
+	rate, changed := c.updateRate.observe(handling, c.waited, now)
+	if !changed {
+		return true
+	}
+	return c.sendRate(rate, config) == nil
+}
+
+func (s *server) handlePair(c *client, cmd command) bool {
+	d, err := s.devices.pair(cmd.Name, c.session.credential)
+	if err != nil {
+		log.Printf("Failed to pair device: %v", err)
+		return c.sendError(errorPairing, err, false)
+	}
+	log.Printf("Client %s paired as device %s (%s)", c.ws.Request().RemoteAddr, d.ID, d.Name)
+	return c.send(pairedMessage{Type: messagePaired, Device: d.ID, Token: d.Token}) == nil
+}
+
+// handleSettings changes the config of the session. The settings of paired
+// devices are stored. All clients of the session receive the new config.
+func (s *server) handleSettings(c *client, cmd command) bool {
+	var changes map[string]json.RawMessage
+	if len(cmd.Config) > 0 {
+		if err := json.Unmarshal(cmd.Config, &changes); err != nil {
+			return c.sendError(errorInvalidCommand, err, false)
+		}
+	}
+	settings := make(map[string]json.RawMessage)
+	s.configMutex.Lock()
+	if !cmd.Reset {
+		maps.Copy(settings, c.session.settings)
+	}
+	_, err := applySettings(s.userConfigs[c.session.credential.user].apply(s.config), mergeSettings(settings, changes))
+	s.configMutex.Unlock()
+	if err != nil {
+		return c.sendError(errorInvalidCommand, err, false)
+	}
+	if device := c.session.credential.device; device != "" {
+		if err := s.devices.saveSettings(device, settings); err != nil {
+			log.Printf("Failed to save settings of device: %v", err)
+			return c.sendError(errorSettings, err, false)
+		}
+	}
+	var updates []configUpdate
+	s.configMutex.Lock()
+	c.session.settings = settings
+	for _, other := range s.sessions.clients() {
+		// The session of clients is only accessible after they are configured
+		if other.configured && other.session == c.session {
+			updates = append(updates, s.configUpdateLocked(other))
+		}
+	}
+	s.configMutex.Unlock()
+	sendConfigUpdates(updates)
+	return true
+}
+
+// mergeSettings applies the changes to the settings. Keys with null values
+// are removed.
+func mergeSettings(settings, changes map[string]json.RawMessage) map[string]json.RawMessage {
+	for key, value := range changes {
+		if string(value) == "null" {
+			delete(settings, key)
+		} else {
+			settings[key] = value
+		}
+	}
+	return settings
+}
+
+// handlePong measures the round-trip time of the ping and reports the latency
+// to the client.
+func (s *server) handlePong(c *client, cmd command) bool {
+	if !c.hasFeature(featureLatency) || cmd.Time <= 0 {
+		return true
+	}
+	roundTrip := time.Since(c.started) - time.Duration(cmd.Time*float64(time.Millisecond))
+	if roundTrip < 0 {
+		return c.sendError(errorInvalidCommand, errors.New("pong from the future"), false)
+	}
+	c.latency.roundTrip.add(roundTrip)
+	return c.send(statsMessage{
+		Type:           messageStats,
+		RoundTripTime:  durationMilliseconds(c.latency.roundTrip.value),
+		ControllerTime: durationMilliseconds(c.latency.controller.value),
+	}) == nil
+}
+
+func (s *server) handleCommand(c *client, cmd command) bool {
+	if cmd.Type == messageScroll {
+		config := c.config.Load()
+		// Legacy clients apply the scroll direction themselves
+		if c.version != protocolVersionLegacy {
+			cmd.X, cmd.Y = config.scrollDirection(cmd.X, cmd.Y, cmd.Wheel)
+		}
+		if config.ScrollAxisLock {
+			cmd.X, cmd.Y = c.scrollLock.filter(cmd.X, cmd.Y, cmd.Finish)
+		} else {
+			c.scrollLock = scrollAxisLock{}
+		}
+	}
+	start := time.Now()
+	err := processCommand(c.session.controller, cmd)
+	c.latency.controller.add(time.Since(start))
+	if err != nil {
+		log.Print(fmt.Errorf("%s controller: %w", s.controllerName, err))
+		var unsupportedErr *inputcontrol.UnsupportedInputError
+		if errors.As(err, &unsupportedErr) {
+			return c.sendError(errorUnsupportedInput, err, false)
+		}
+		if err := c.session.controller.Release(); err != nil {
+			log.Printf("Failed to release pointer buttons: %v", err)
+		}
+		return c.sendError(errorController, err, true)
+	}
+	return true
+}
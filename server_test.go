@@ -0,0 +1,1128 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unrud/remote-touchpad/inputcontrol"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	testSecret      string = "secret"
+	unsupportedText string = "☃"
+)
+
+type recordingController struct {
+	mutex sync.Mutex
+	calls []string
+}
+
+func (p *recordingController) record(format string, a ...any) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.calls = append(p.calls, fmt.Sprintf(format, a...))
+	return nil
+}
+
+func (p *recordingController) Calls() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]string(nil), p.calls...)
+}
+
+func (p *recordingController) Close() error {
+	return nil
+}
+
+func (p *recordingController) KeyboardText(text string) error {
+	if text == unsupportedText {
+		return &inputcontrol.UnsupportedInputError{Err: fmt.Errorf("unsupported rune: %q", text)}
+	}
+	return p.record("text %s", text)
+}
+
+func (p *recordingController) KeyboardKey(key inputcontrol.Key) error {
+	return p.record("key %d", key)
+}
+
+func (p *recordingController) PointerButton(button inputcontrol.PointerButton, press bool) error {
+	return p.record("button %d %t", button, press)
+}
+
+func (p *recordingController) PointerMove(deltaX, deltaY int) error {
+	return p.record("move %d %d", deltaX, deltaY)
+}
+
+func (p *recordingController) PointerScroll(deltaHorizontal, deltaVertical int, finish bool) error {
+	return p.record("scroll %d %d %t", deltaHorizontal, deltaVertical, finish)
+}
+
+func legacyChallengeResponse(message, secret string) string {
+	mac := hmac.New(sha256.New, []byte(message))
+	mac.Write([]byte(secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func challengeResponse(message, secret string, encryption bool) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	if encryption {
+		mac.Write([]byte(":" + featureEncryption))
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newTestServer(options ...func(*server)) (*server, *recordingController) {
+	controller := &recordingController{}
+	s := &server{
+		controllerName: "test",
+		config: config{
+			UpdateRate: 30, MoveSpeed: 1, ScrollSpeed: 1, MouseMoveSpeed: 1, MouseScrollSpeed: 1,
+			Acceleration: defaultAcceleration, TouchMoveThreshold: defaultTouchMoveThreshold,
+			TouchTimeout: defaultTouchTimeout, TapToDrag: true, NaturalScrolling: true,
+		},
+		credentials:      []*credential{{secret: testSecret, scopes: allScopes}},
+		lockout:          newAuthLockout(0, 0, 0),
+		challengeTimeout: time.Minute,
+		legacyAuth:       true,
+		sessions:         newSessionRegistry(controller, time.Minute),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s, controller
+}
+
+func startTestServer(t *testing.T, options ...func(*server)) (*server, *recordingController, string) {
+	t.Helper()
+	s, controller := newTestServer(options...)
+	httpServer := httptest.NewServer(websocket.Handler(s.handleWebSocket))
+	t.Cleanup(httpServer.Close)
+	return s, controller, "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+func dialTestServer(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	ws, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+func receiveJSON(t *testing.T, ws *websocket.Conn) map[string]any {
+	t.Helper()
+	var message map[string]any
+	if err := websocket.JSON.Receive(ws, &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func sendHello(t *testing.T, ws *websocket.Conn, hello map[string]any) string {
+	t.Helper()
+	return sendHelloWithSecret(t, ws, testSecret, hello)
+}
+
+// sendHelloWithSecret answers the challenge and returns it.
+func sendHelloWithSecret(t *testing.T, ws *websocket.Conn, secret string, hello map[string]any) string {
+	t.Helper()
+	var challenge string
+	if err := websocket.Message.Receive(ws, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	hello["type"] = messageHello
+	if _, ok := hello["auth"]; !ok {
+		hello["auth"] = authScheme
+	}
+	if _, ok := hello["response"]; !ok && hello["auth"] == authSchemeLegacy {
+		hello["response"] = legacyChallengeResponse(challenge, secret)
+	} else if !ok {
+		features, _ := hello["features"].([]string)
+		hello["response"] = challengeResponse(challenge, secret, slices.Contains(features, featureEncryption))
+	}
+	if err := websocket.JSON.Send(ws, hello); err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+func waitForCalls(t *testing.T, controller *recordingController, expected ...string) {
+	t.Helper()
+	for range 100 {
+		if len(controller.Calls()) >= len(expected) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if calls := controller.Calls(); strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected controller calls: %#v", calls)
+	}
+}
+
+func TestLegacyProtocol(t *testing.T) {
+	_, controller, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	var challenge string
+	if err := websocket.Message.Receive(ws, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	websocket.Message.Send(ws, legacyChallengeResponse(challenge, testSecret))
+	if config := receiveJSON(t, ws); config["updateRate"] != 30.0 || config["type"] != nil {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	for _, message := range []string{"m1;-2", "s3;4", "S", "b0;1", "k2", "tä"} {
+		websocket.Message.Send(ws, message)
+	}
+	waitForCalls(t, controller, "move 1 -2", "scroll 3 4 false", "scroll 0 0 true",
+		"button 0 true", "key 2", "text ä")
+}
+
+func TestProtocolHandshake(t *testing.T) {
+	_, controller, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2, 3}, "features": []string{"unknown"}})
+	hello := receiveJSON(t, ws)
+	if hello["type"] != messageHello || hello["version"] != 2.0 {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	if features := hello["features"].([]any); len(features) != 0 {
+		t.Fatalf("unexpected features: %#v", features)
+	}
+	if config := receiveJSON(t, ws); config["type"] != messageConfig || config["moveSpeed"] != 1.0 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	websocket.JSON.Send(ws, command{Type: messageMove, X: 5, Y: 6})
+	websocket.JSON.Send(ws, command{Type: messageButton, Button: 1, Press: true})
+	waitForCalls(t, controller, "move 5 6", "button 1 true")
+}
+
+func TestProtocolVersionMismatch(t *testing.T) {
+	_, _, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{99}})
+	hello := receiveJSON(t, ws)
+	if hello["version"] != 0.0 || len(hello["versions"].([]any)) == 0 {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	if message := receiveJSON(t, ws); message["code"] != errorUnsupportedVersion || message["fatal"] != true {
+		t.Fatalf("unexpected error: %#v", message)
+	}
+	var message string
+	if err := websocket.Message.Receive(ws, &message); err == nil {
+		t.Fatalf("connection not closed: %#v", message)
+	}
+}
+
+func TestNegotiateProtocolDowngrade(t *testing.T) {
+	version, features, err := negotiateProtocol(clientHello{Versions: []int{1}, Features: protocolFeatures})
+	if err != nil || version != protocolVersionLegacy || len(features) != 0 {
+		t.Fatalf("unexpected result: %v %v %v", version, features, err)
+	}
+}
+
+func TestRecoverableErrors(t *testing.T) {
+	_, controller, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}})
+	receiveJSON(t, ws)
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageText, Text: unsupportedText})
+	if message := receiveJSON(t, ws); message["code"] != errorUnsupportedInput || message["fatal"] != false {
+		t.Fatalf("unexpected error: %#v", message)
+	}
+	websocket.JSON.Send(ws, command{Type: "unknown"})
+	if message := receiveJSON(t, ws); message["code"] != errorInvalidCommand || message["fatal"] != false {
+		t.Fatalf("unexpected error: %#v", message)
+	}
+	websocket.JSON.Send(ws, command{Type: messageKey, Key: int(inputcontrol.KeyLimit)})
+	if message := receiveJSON(t, ws); message["code"] != errorUnsupportedInput {
+		t.Fatalf("unexpected error: %#v", message)
+	}
+	websocket.JSON.Send(ws, command{Type: messageText, Text: "ok"})
+	waitForCalls(t, controller, "text ok")
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	_, _, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	var challenge string
+	if err := websocket.Message.Receive(ws, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	websocket.JSON.Send(ws, clientHello{Type: messageHello, Response: "wrong", Versions: []int{2}})
+	if message := receiveJSON(t, ws); message["code"] != errorUnauthorized || message["fatal"] != true {
+		t.Fatalf("unexpected error: %#v", message)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	_, controller, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureBatch}})
+	if hello := receiveJSON(t, ws); hello["features"].([]any)[0] != featureBatch {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageBatch, Commands: []command{
+		{Type: messageMove, X: 1, Y: 2},
+		{Type: messageMove, X: 3, Y: 4},
+		{Type: messageScroll, X: 5, Y: 6},
+		{Type: messageText, Text: unsupportedText},
+		{Type: messageMove, X: 7, Y: 8},
+		{Type: messageScroll, Finish: true},
+	}})
+	if message := receiveJSON(t, ws); message["code"] != errorUnsupportedInput {
+		t.Fatalf("unexpected error: %#v", message)
+	}
+	waitForCalls(t, controller, "move 4 6", "scroll -5 -6 false", "move 7 8", "scroll 0 0 true")
+}
+
+func TestBatchWithoutFeature(t *testing.T) {
+	_, controller, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}})
+	receiveJSON(t, ws)
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageBatch, Commands: []command{{Type: messageMove, X: 1}}})
+	if message := receiveJSON(t, ws); message["code"] != errorInvalidCommand {
+		t.Fatalf("unexpected error: %#v", message)
+	}
+	websocket.JSON.Send(ws, command{Type: messageMove, X: 2})
+	waitForCalls(t, controller, "move 2 0")
+}
+
+func TestHeartbeat(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) {
+		s.pingInterval = 20 * time.Millisecond
+		s.pingTimeout = 200 * time.Millisecond
+	})
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureHeartbeat}})
+	if hello := receiveJSON(t, ws); hello["pingInterval"] != 20.0 || hello["pingTimeout"] != 200.0 {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	receiveJSON(t, ws)
+	start := time.Now()
+	for time.Since(start) < 500*time.Millisecond {
+		if message := receiveJSON(t, ws); message["type"] != messagePing {
+			t.Fatalf("unexpected message: %#v", message)
+		}
+		websocket.JSON.Send(ws, pingMessage{Type: messagePong})
+	}
+	// Stop answering
+	var message string
+	for {
+		if err := websocket.Message.Receive(ws, &message); err != nil {
+			break
+		}
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("connection not closed in time")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) {
+		s.pingInterval = 20 * time.Millisecond
+	})
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureHeartbeat, featureLatency}})
+	if hello := receiveJSON(t, ws); fmt.Sprint(hello["features"]) != "[heartbeat latency]" {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageMove, X: 1})
+	websocket.JSON.Send(ws, pingMessage{Type: messagePing, Time: 1234.5})
+	if pong := receiveJSON(t, ws); pong["type"] != messagePong || pong["time"] != 1234.5 {
+		t.Fatalf("unexpected pong: %#v", pong)
+	}
+	ping := receiveJSON(t, ws)
+	pingTime, _ := ping["time"].(float64)
+	if ping["type"] != messagePing || pingTime <= 0 {
+		t.Fatalf("unexpected ping: %#v", ping)
+	}
+	time.Sleep(10 * time.Millisecond)
+	websocket.JSON.Send(ws, pingMessage{Type: messagePong, Time: pingTime})
+	for {
+		message := receiveJSON(t, ws)
+		if message["type"] == messagePing {
+			continue
+		}
+		roundTrip, _ := message["roundTripTime"].(float64)
+		if message["type"] != messageStats || roundTrip < 10 || message["controllerTime"] == nil {
+			t.Fatalf("unexpected stats: %#v", message)
+		}
+		break
+	}
+
+	// Without heartbeat
+	ws = dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureLatency}})
+	if hello := receiveJSON(t, ws); fmt.Sprint(hello["features"]) != "[]" {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+}
+
+func TestAdaptiveUpdateRate(t *testing.T) {
+	_, controller, url := startTestServer(t, func(s *server) {
+		s.adaptiveUpdateRate = true
+		s.minUpdateRate = 10
+		s.maxUpdateRate = 60
+	})
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureAdaptiveRate}})
+	if hello := receiveJSON(t, ws); fmt.Sprint(hello["features"]) != "[adaptive-rate]" {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageMove, X: 1})
+	time.Sleep(updateRateHoldTime)
+	websocket.JSON.Send(ws, command{Type: messageMove, X: 2})
+	if message := receiveJSON(t, ws); message["type"] != messageRate || message["updateRate"] != 35.0 {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	waitForCalls(t, controller, "move 1 0", "move 2 0")
+}
+
+func TestAdaptiveUpdateRateDisabled(t *testing.T) {
+	_, _, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureAdaptiveRate}})
+	if hello := receiveJSON(t, ws); fmt.Sprint(hello["features"]) != "[]" {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+}
+
+func TestResumeSession(t *testing.T) {
+	_, _, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureResume}})
+	hello := receiveJSON(t, ws)
+	token, _ := hello["session"].(string)
+	if token == "" || hello["resumed"] != nil || hello["resumeTimeout"] != 60000.0 {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	receiveJSON(t, ws)
+	// Resume while the old connection is still open
+	ws2 := dialTestServer(t, url)
+	sendHello(t, ws2, map[string]any{"versions": []int{2}, "features": []string{featureResume}, "resume": token})
+	hello = receiveJSON(t, ws2)
+	if hello["resumed"] != true || hello["session"] == token {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	var message string
+	if err := websocket.Message.Receive(ws, &message); err == nil {
+		t.Fatalf("old connection not closed: %#v", message)
+	}
+	// Tokens are single-use
+	ws3 := dialTestServer(t, url)
+	sendHello(t, ws3, map[string]any{"versions": []int{2}, "features": []string{featureResume}, "resume": token})
+	if hello = receiveJSON(t, ws3); hello["resumed"] != nil {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	s, _, url := startTestServer(t, func(s *server) {
+		s.sessions = newSessionRegistry(s.sessions.controller, 50*time.Millisecond)
+	})
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureResume}})
+	token := receiveJSON(t, ws)["session"].(string)
+	ws.Close()
+	time.Sleep(200 * time.Millisecond)
+	s.sessions.mutex.Lock()
+	_, found := s.sessions.tokens[token]
+	s.sessions.mutex.Unlock()
+	if found {
+		t.Fatal("session not expired")
+	}
+}
+
+func TestReleaseButtonsOnDisconnect(t *testing.T) {
+	_, controller, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}})
+	receiveJSON(t, ws)
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageButton, Button: 0, Press: true})
+	websocket.JSON.Send(ws, command{Type: messageButton, Button: 2, Press: true})
+	websocket.JSON.Send(ws, command{Type: messageButton, Button: 2, Press: false})
+	waitForCalls(t, controller, "button 0 true", "button 2 true", "button 2 false")
+	ws.Close()
+	waitForCalls(t, controller, "button 0 true", "button 2 true", "button 2 false", "button 0 false")
+}
+
+func TestReleaseButtonsOnShutdown(t *testing.T) {
+	s, controller, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureResume}})
+	receiveJSON(t, ws)
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageButton, Button: 1, Press: true})
+	waitForCalls(t, controller, "button 1 true")
+	s.sessions.closeAll()
+	waitForCalls(t, controller, "button 1 true", "button 1 false")
+	var message string
+	if err := websocket.Message.Receive(ws, &message); err == nil {
+		t.Fatalf("connection not closed: %#v", message)
+	}
+}
+
+func connectTestClient(t *testing.T, url string, features ...string) *websocket.Conn {
+	t.Helper()
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": features})
+	if message := receiveJSON(t, ws); message["type"] != messageHello {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	receiveJSON(t, ws)
+	return ws
+}
+
+func TestExclusivePolicy(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) {
+		s.sessions.policy = policyExclusive
+	})
+	ws := connectTestClient(t, url)
+	ws2 := dialTestServer(t, url)
+	sendHello(t, ws2, map[string]any{"versions": []int{2}})
+	if message := receiveJSON(t, ws2); message["code"] != errorBusy || message["fatal"] != true {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	ws.Close()
+	time.Sleep(50 * time.Millisecond)
+	connectTestClient(t, url)
+}
+
+func TestTakeoverPolicy(t *testing.T) {
+	_, controller, url := startTestServer(t, func(s *server) {
+		s.sessions.policy = policyTakeover
+	})
+	ws := connectTestClient(t, url)
+	websocket.JSON.Send(ws, command{Type: messageButton, Button: 0, Press: true})
+	waitForCalls(t, controller, "button 0 true")
+	connectTestClient(t, url)
+	if message := receiveJSON(t, ws); message["code"] != errorTakenOver || message["fatal"] != true {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	waitForCalls(t, controller, "button 0 true", "button 0 false")
+}
+
+func TestMaxClients(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) {
+		s.sessions.maxClients = 2
+	})
+	connectTestClient(t, url)
+	connectTestClient(t, url)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}})
+	if message := receiveJSON(t, ws); message["code"] != errorBusy {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := parseScopes("text, media,text")
+	if err != nil || !slices.Equal(scopes, []string{scopeText, scopeMedia}) {
+		t.Fatalf("unexpected scopes: %#v (%v)", scopes, err)
+	}
+	if scopes, _ := parseScopes(scopeAll); !slices.Equal(scopes, allScopes) {
+		t.Fatalf("unexpected scopes: %#v", scopes)
+	}
+	if _, err := parseScopes("pointer,unknown"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestGuestScopes(t *testing.T) {
+	_, controller, url := startTestServer(t, func(s *server) {
+		s.credentials = append(s.credentials,
+			&credential{secret: "guest", scopes: []string{scopeMedia}})
+	})
+	ws := dialTestServer(t, url)
+	sendHelloWithSecret(t, ws, "guest", map[string]any{"versions": []int{2}})
+	if hello := receiveJSON(t, ws); fmt.Sprint(hello["scopes"]) != "[media]" {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageMove, X: 1, Y: 1})
+	if message := receiveJSON(t, ws); message["code"] != errorForbidden || message["fatal"] != false {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	websocket.JSON.Send(ws, command{Type: messageKey, Key: int(inputcontrol.KeyVolumeUp)})
+	waitForCalls(t, controller, fmt.Sprintf("key %d", inputcontrol.KeyVolumeUp))
+}
+
+func TestLegacyAuthentication(t *testing.T) {
+	_, _, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"auth": authSchemeLegacy, "versions": []int{2}})
+	if hello := receiveJSON(t, ws); hello["type"] != messageHello {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+
+	_, _, url = startTestServer(t, func(s *server) { s.legacyAuth = false })
+	ws = dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"auth": authSchemeLegacy, "versions": []int{2}})
+	if message := receiveJSON(t, ws); message["code"] != errorUnauthorized {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	ws = dialTestServer(t, url)
+	var challenge string
+	if err := websocket.Message.Receive(ws, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	websocket.Message.Send(ws, legacyChallengeResponse(challenge, testSecret))
+	if err := websocket.Message.Receive(ws, &challenge); err == nil {
+		t.Fatal("expected connection to be closed")
+	}
+}
+
+func TestChallengeExpiry(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) { s.challengeTimeout = -time.Second })
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}})
+	if message := receiveJSON(t, ws); message["code"] != errorUnauthorized ||
+		message["message"] != errChallengeExpired.Error() {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+func TestChallengeSingleUse(t *testing.T) {
+	c := &challenge{message: secureRandBase64(challengeLength)}
+	credentials := []*credential{{secret: testSecret, scopes: allScopes}}
+	response := challengeResponse(c.message, testSecret, false)
+	if cred, err := c.authenticate(credentials, authScheme, response, false); err != nil || cred != credentials[0] {
+		t.Fatalf("authentication failed: %v", err)
+	}
+	if _, err := c.authenticate(credentials, authScheme, response, false); err != errChallengeUsed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAuthenticationLockout(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) { s.lockout = newAuthLockout(time.Minute, 0, 0) })
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"response": "wrong", "versions": []int{2}})
+	if message := receiveJSON(t, ws); message["code"] != errorUnauthorized {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	ws = dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}})
+	if message := receiveJSON(t, ws); message["code"] != errorLockedOut {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+func TestAuthenticationBan(t *testing.T) {
+	lockout := newAuthLockout(0, 2, time.Minute)
+	fail := func() error { return errAuthentication }
+	succeed := func() error { return nil }
+	if err := lockout.attempt("192.0.2.1:1000", succeed); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := lockout.attempt("192.0.2.1:1000", fail); err != errAuthentication {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	var lockedOutErr *lockedOutError
+	if err := lockout.attempt("192.0.2.1:1001", succeed); !errors.As(err, &lockedOutErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := lockout.attempt("192.0.2.2:1000", succeed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAuthenticationConcurrent(t *testing.T) {
+	lockout := newAuthLockout(time.Minute, 0, 0)
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- lockout.attempt("192.0.2.1:1000", func() error {
+			<-release
+			return errAuthentication
+		})
+	}()
+	// Slow attempts don't block others
+	if err := lockout.attempt("192.0.2.2:1000", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != errAuthentication {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var lockedOutErr *lockedOutError
+	if err := lockout.attempt("192.0.2.1:1001", func() error { return nil }); !errors.As(err, &lockedOutErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDevicePairing(t *testing.T) {
+	devices := newDeviceStore(filepath.Join(t.TempDir(), "devices.json"))
+	_, _, url := startTestServer(t, func(s *server) { s.devices = devices })
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featurePairing}})
+	if hello := receiveJSON(t, ws); fmt.Sprint(hello["features"]) != "[pairing]" {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messagePair, Name: "phone"})
+	paired := receiveJSON(t, ws)
+	deviceID, _ := paired["device"].(string)
+	token, _ := paired["token"].(string)
+	if paired["type"] != messagePaired || deviceID == "" || token == "" {
+		t.Fatalf("unexpected message: %#v", paired)
+	}
+
+	ws = dialTestServer(t, url)
+	sendHelloWithSecret(t, ws, token, map[string]any{"versions": []int{2}, "device": deviceID})
+	if hello := receiveJSON(t, ws); hello["type"] != messageHello {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	if list, err := devices.list(); err != nil || len(list) != 1 ||
+		list[0].Name != "phone" || list[0].LastSeen.IsZero() {
+		t.Fatalf("unexpected devices: %#v (%v)", list, err)
+	}
+
+	if err := devices.revoke(deviceID); err != nil {
+		t.Fatal(err)
+	}
+	ws = dialTestServer(t, url)
+	sendHelloWithSecret(t, ws, token, map[string]any{"versions": []int{2}, "device": deviceID})
+	if message := receiveJSON(t, ws); message["code"] != errorUnauthorized {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+func TestPairingForbidden(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) {
+		s.devices = newDeviceStore(filepath.Join(t.TempDir(), "devices.json"))
+		s.credentials = append(s.credentials, &credential{secret: "guest", scopes: []string{scopePointer}})
+	})
+	ws := dialTestServer(t, url)
+	sendHelloWithSecret(t, ws, "guest", map[string]any{"versions": []int{2}, "features": []string{featurePairing}})
+	receiveJSON(t, ws)
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messagePair, Name: "phone"})
+	if message := receiveJSON(t, ws); message["code"] != errorForbidden {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+func TestPairingLimit(t *testing.T) {
+	devices := newDeviceStore(filepath.Join(t.TempDir(), "devices.json"))
+	cred := &credential{secret: testSecret, scopes: allScopes}
+	for range maxDevices {
+		if _, err := devices.pair("phone", cred); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := devices.pair("phone", cred); err != errTooManyDevices {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPairingDisabled(t *testing.T) {
+	_, _, url := startTestServer(t)
+	ws := connectTestClient(t, url, featurePairing)
+	websocket.JSON.Send(ws, command{Type: messagePair, Name: "phone"})
+	if message := receiveJSON(t, ws); message["code"] != errorInvalidCommand {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	s, _, url := startTestServer(t)
+	ws := connectTestClient(t, url)
+	legacyWs := dialTestServer(t, url)
+	var challenge string
+	if err := websocket.Message.Receive(legacyWs, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	websocket.Message.Send(legacyWs, legacyChallengeResponse(challenge, testSecret))
+	receiveJSON(t, legacyWs)
+	s.updateConfig(config{UpdateRate: 60, MoveSpeed: 2, ScrollSpeed: 1}, nil)
+	if config := receiveJSON(t, ws); config["type"] != messageConfig || config["updateRate"] != 60.0 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	if config := receiveJSON(t, legacyWs); config["moveSpeed"] != 2.0 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+}
+
+func TestUserConfig(t *testing.T) {
+	user, overrides, err := parseUser(`{"name": "alice", "secret": "alice", "scopes": "pointer", "move-speed": 3}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _, url := startTestServer(t, func(s *server) {
+		s.credentials = append(s.credentials, user)
+		s.userConfigs = map[string]configOverrides{"alice": overrides}
+	})
+	ws := dialTestServer(t, url)
+	sendHelloWithSecret(t, ws, "alice", map[string]any{"versions": []int{2}})
+	if hello := receiveJSON(t, ws); fmt.Sprint(hello["scopes"]) != "[pointer]" {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	if config := receiveJSON(t, ws); config["moveSpeed"] != 3.0 || config["updateRate"] != 30.0 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	otherWs := connectTestClient(t, url)
+	s.updateConfig(config{UpdateRate: 60, MoveSpeed: 2, ScrollSpeed: 1}, s.userConfigs)
+	if config := receiveJSON(t, ws); config["moveSpeed"] != 3.0 || config["updateRate"] != 60.0 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	if config := receiveJSON(t, otherWs); config["moveSpeed"] != 2.0 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+}
+
+func TestParseUserErrors(t *testing.T) {
+	for value, expected := range map[string]string{
+		`{"secret": "a"}`:                      "name missing",
+		`{"name": "a", "scopes": "invalid"}`:   "invalid",
+		`{"name": "a", "update-rate": 0}`:      "update-rate",
+		`{"name": "a", "touch-timeout": "0s"}`: "touch-timeout",
+		`{"name": "a", "speed": 1}`:            "unknown field",
+	} {
+		if _, _, err := parseUser(value); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: unexpected error: %v", value, err)
+		}
+	}
+}
+
+func receiveEncryptedJSON(t *testing.T, ws *websocket.Conn, cipher *messageCipher) map[string]any {
+	t.Helper()
+	var sealed string
+	if err := websocket.Message.Receive(ws, &sealed); err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := cipher.open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message map[string]any
+	if err := json.Unmarshal(plaintext, &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func sendEncryptedJSON(t *testing.T, ws *websocket.Conn, cipher *messageCipher, v any) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := websocket.Message.Send(ws, cipher.seal(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	_, controller, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	challenge := sendHello(t, ws, map[string]any{"versions": []int{2}, "features": []string{featureEncryption}})
+	if hello := receiveJSON(t, ws); fmt.Sprint(hello["features"]) != "[encryption]" {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	cipher, err := newMessageCipher(testSecret, challenge, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config := receiveEncryptedJSON(t, ws, cipher); config["type"] != messageConfig {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	sendEncryptedJSON(t, ws, cipher, command{Type: messageMove, X: 1, Y: 2})
+	sendEncryptedJSON(t, ws, cipher, command{Type: messageText, Text: "x"})
+	waitForCalls(t, controller, "move 1 2", "text x")
+
+	// Replayed message
+	replay := &messageCipher{send: cipher.send}
+	replay.send.sequence--
+	sendEncryptedJSON(t, ws, replay, command{Type: messageText, Text: "x"})
+	if message := receiveEncryptedJSON(t, ws, cipher); message["code"] != errorDecryption {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	var message string
+	if err := websocket.Message.Receive(ws, &message); err == nil {
+		t.Fatal("expected connection to be closed")
+	}
+}
+
+func TestEncryptionStripped(t *testing.T) {
+	_, _, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	var challenge string
+	if err := websocket.Message.Receive(ws, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	// The response of a client that requested encryption
+	websocket.JSON.Send(ws, map[string]any{
+		"type": messageHello, "auth": authScheme, "versions": []int{2}, "features": []string{},
+		"response": challengeResponse(challenge, testSecret, true),
+	})
+	if message := receiveJSON(t, ws); message["code"] != errorUnauthorized {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+func TestRequireEncryption(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) { s.requireEncryption = true })
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"versions": []int{2}})
+	if message := receiveJSON(t, ws); message["code"] != errorEncryptionRequired {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+// pairWithPIN runs the key exchange and returns the challenge and the keys of
+// the client.
+func pairWithPIN(t *testing.T, ws *websocket.Conn, pin string) (string, pakeKeys) {
+	t.Helper()
+	var challenge string
+	if err := websocket.Message.Receive(ws, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	client := newPAKEClient(t, pin)
+	websocket.JSON.Send(ws, map[string]any{
+		"type": messageHello, "auth": authSchemePIN, "versions": []int{2},
+		"features": []string{featurePairing, featureEncryption}, "pake": encodePAKEElement(client.element),
+	})
+	pake := receiveJSON(t, ws)
+	element, _ := pake["element"].(string)
+	if pake["type"] != messagePAKE {
+		t.Fatalf("unexpected message: %#v", pake)
+	}
+	keys := client.finish(t, challenge, element)
+	websocket.JSON.Send(ws, pakeMessage{Type: messagePAKE, Confirmation: keys.confirmation})
+	return challenge, keys
+}
+
+func TestPINPairing(t *testing.T) {
+	pins := make(chan string, 10)
+	devices := newDeviceStore(filepath.Join(t.TempDir(), "devices.json"))
+	_, _, url := startTestServer(t, func(s *server) {
+		s.devices = devices
+		s.pins = newPINPairing(func(pin string) { pins <- pin })
+	})
+	ws := dialTestServer(t, url)
+	challenge, keys := pairWithPIN(t, ws, <-pins)
+	if hello := receiveJSON(t, ws); fmt.Sprint(hello["features"]) != "[pairing encryption]" {
+		t.Fatalf("unexpected hello: %#v", hello)
+	}
+	cipher, err := newMessageCipher(keys.secret, challenge, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveEncryptedJSON(t, ws, cipher)
+	sendEncryptedJSON(t, ws, cipher, command{Type: messagePair, Name: "phone"})
+	if paired := receiveEncryptedJSON(t, ws, cipher); paired["type"] != messagePaired {
+		t.Fatalf("unexpected message: %#v", paired)
+	}
+
+	// The PIN is renewed after every attempt
+	<-pins
+	ws = dialTestServer(t, url)
+	pairWithPIN(t, ws, "wrong")
+	if message := receiveJSON(t, ws); message["code"] != errorUnauthorized {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	select {
+	case <-pins:
+	case <-time.After(5 * time.Second):
+		t.Fatal("PIN wasn't renewed")
+	}
+}
+
+func TestPINPairingDisabled(t *testing.T) {
+	_, _, url := startTestServer(t)
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"auth": authSchemePIN, "versions": []int{2}})
+	if message := receiveJSON(t, ws); message["code"] != errorUnauthorized {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+func TestPINPairingLockout(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) {
+		s.lockout = newAuthLockout(time.Minute, 0, 0)
+		s.pins = newPINPairing(func(string) {})
+	})
+	// Invalid exchanges count as failed attempts
+	for _, expected := range []string{errorUnauthorized, errorLockedOut} {
+		ws := dialTestServer(t, url)
+		sendHello(t, ws, map[string]any{
+			"auth": authSchemePIN, "versions": []int{2}, "features": []string{featureEncryption}, "pake": "invalid",
+		})
+		if message := receiveJSON(t, ws); message["code"] != expected {
+			t.Fatalf("unexpected message: %#v", message)
+		}
+	}
+}
+
+func TestPINPairingAbandoned(t *testing.T) {
+	pins := make(chan string, 10)
+	_, _, url := startTestServer(t, func(s *server) {
+		s.challengeTimeout = 200 * time.Millisecond
+		s.lockout = newAuthLockout(time.Minute, 0, 0)
+		s.pins = newPINPairing(func(pin string) { pins <- pin })
+	})
+	<-pins
+	ws := dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{
+		"auth": authSchemePIN, "versions": []int{2}, "features": []string{featureEncryption},
+		"pake": encodePAKEElement(newPAKEClient(t, "000000").element),
+	})
+	if message := receiveJSON(t, ws); message["type"] != messagePAKE {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	// The PIN is released and the attempt counts as failed
+	if message := receiveJSON(t, ws); message["code"] != errorUnauthorized {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+	select {
+	case <-pins:
+	case <-time.After(5 * time.Second):
+		t.Fatal("PIN wasn't renewed")
+	}
+	ws = dialTestServer(t, url)
+	sendHello(t, ws, map[string]any{"auth": authSchemePIN, "versions": []int{2}, "features": []string{featureEncryption}})
+	if message := receiveJSON(t, ws); message["code"] != errorLockedOut {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	devices := newDeviceStore(filepath.Join(t.TempDir(), "devices.json"))
+	_, _, url := startTestServer(t, func(s *server) { s.devices = devices })
+	ws := connectTestClient(t, url, featurePairing)
+	websocket.JSON.Send(ws, command{Type: messagePair, Name: "phone"})
+	paired := receiveJSON(t, ws)
+	deviceID, _ := paired["device"].(string)
+	token, _ := paired["token"].(string)
+
+	ws = dialTestServer(t, url)
+	sendHelloWithSecret(t, ws, token, map[string]any{"versions": []int{2}, "device": deviceID})
+	receiveJSON(t, ws)
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageSettings, Config: json.RawMessage(`{"moveSpeed": 2.5, "updateRate": 60}`)})
+	if config := receiveJSON(t, ws); config["moveSpeed"] != 2.5 || config["updateRate"] != 60.0 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	websocket.JSON.Send(ws, command{Type: messageSettings, Config: json.RawMessage(`{"updateRate": null}`)})
+	if config := receiveJSON(t, ws); config["moveSpeed"] != 2.5 || config["updateRate"] != 30.0 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	websocket.JSON.Send(ws, command{Type: messageSettings, Config: json.RawMessage(`{"touchTimeout": 400, "tapToDrag": false}`)})
+	if config := receiveJSON(t, ws); config["touchTimeout"] != 400.0 || config["tapToDrag"] != false {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	websocket.JSON.Send(ws, command{Type: messageSettings, Config: json.RawMessage(`{"acceleration": "0:1,100:2"}`)})
+	if config := receiveJSON(t, ws); fmt.Sprint(config["acceleration"]) != "map[points:[[0 1] [100 2]] profile:custom]" {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	for _, invalid := range []string{
+		`{"updateRate": 0}`, `{"updateRate": 1000000}`, `{"moveSpeed": 0}`, `{"scrollSpeed": -1}`,
+		`{"mouseMoveSpeed": 1000}`, `{"mouseScrollSpeed": 0}`, `{"unknown": 1}`, `[]`,
+		`{"acceleration": "linear"}`, `{"touchTimeout": 0}`,
+	} {
+		websocket.JSON.Send(ws, command{Type: messageSettings, Config: json.RawMessage(invalid)})
+		if message := receiveJSON(t, ws); message["code"] != errorInvalidCommand {
+			t.Fatalf("%s: unexpected message: %#v", invalid, message)
+		}
+	}
+
+	// Settings are restored for the device
+	ws = dialTestServer(t, url)
+	sendHelloWithSecret(t, ws, token, map[string]any{"versions": []int{2}, "device": deviceID})
+	receiveJSON(t, ws)
+	if config := receiveJSON(t, ws); config["moveSpeed"] != 2.5 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	websocket.JSON.Send(ws, command{Type: messageSettings, Reset: true})
+	if config := receiveJSON(t, ws); config["moveSpeed"] != 1.0 {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	if list, err := devices.list(); err != nil || len(list[0].Settings) != 0 {
+		t.Fatalf("unexpected devices: %#v (%v)", list, err)
+	}
+}
+
+func TestScrollAxisLockSetting(t *testing.T) {
+	_, controller, url := startTestServer(t)
+	ws := connectTestClient(t, url)
+	websocket.JSON.Send(ws, command{Type: messageSettings, Config: json.RawMessage(`{"scrollAxisLock": true}`)})
+	if config := receiveJSON(t, ws); config["scrollAxisLock"] != true {
+		t.Fatalf("unexpected config: %#v", config)
+	}
+	websocket.JSON.Send(ws, command{Type: messageScroll, X: 1, Y: 4})
+	websocket.JSON.Send(ws, command{Type: messageScroll, X: 3, Y: 1, Finish: true})
+	websocket.JSON.Send(ws, command{Type: messageScroll, X: 2, Y: 1})
+	waitForCalls(t, controller, "scroll 0 -4 false", "scroll 0 -1 true", "scroll -2 0 false")
+}
+
+func TestScrollDirection(t *testing.T) {
+	_, controller, url := startTestServer(t)
+	ws := connectTestClient(t, url)
+	// Natural scrolling only applies to gestures by default
+	websocket.JSON.Send(ws, command{Type: messageScroll, X: 1, Y: 2, Finish: true})
+	websocket.JSON.Send(ws, command{Type: messageScroll, X: 1, Y: 2, Finish: true, Wheel: true})
+	websocket.JSON.Send(ws, command{Type: messageSettings, Config: json.RawMessage(
+		`{"naturalScrolling": false, "mouseNaturalScrolling": true}`)})
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageScroll, X: 1, Y: 2, Finish: true})
+	websocket.JSON.Send(ws, command{Type: messageScroll, X: 1, Y: 2, Finish: true, Wheel: true})
+	waitForCalls(t, controller, "scroll -1 -2 true", "scroll 1 2 true", "scroll 1 2 true", "scroll -1 -2 true")
+}
+
+func TestSettingsForbidden(t *testing.T) {
+	_, _, url := startTestServer(t, func(s *server) {
+		s.credentials = append(s.credentials, &credential{secret: "guest", scopes: []string{scopePointer}})
+	})
+	ws := dialTestServer(t, url)
+	sendHelloWithSecret(t, ws, "guest", map[string]any{"versions": []int{2}})
+	receiveJSON(t, ws)
+	receiveJSON(t, ws)
+	websocket.JSON.Send(ws, command{Type: messageSettings, Config: json.RawMessage(`{"moveSpeed": 2}`)})
+	if message := receiveJSON(t, ws); message["code"] != errorForbidden {
+		t.Fatalf("unexpected message: %#v", message)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/unrud/remote-touchpad/inputcontrol"
+)
+
+const resumeTokenLength int = 32
+
+// Policies for multiple clients:
+//   - shared: all clients control the input simultaneously
+//   - exclusive: the first client keeps control, others are rejected
+//   - takeover: new clients disconnect all other clients
+const (
+	policyShared    string = "shared"
+	policyExclusive string = "exclusive"
+	policyTakeover  string = "takeover"
+)
+
+var clientPolicies = []string{policyShared, policyExclusive, policyTakeover}
+
+var errBusy = errors.New("another client is in control")
+
+type tooManyClientsError struct {
+	max int
+}
+
+func (e *tooManyClientsError) Error() string {
+	return fmt.Sprintf("too many clients (maximum %d)", e.max)
+}
+
+// session holds the state of an authenticated client. With the resume
+// feature, sessions outlive the connection for the resume timeout and clients
+// can reattach to them with the resume token.
+type session struct {
+	token      string
+	client     *client
+	credential *credential
+	controller *trackingController
+	expiry     *time.Timer
+	// Config changed by the client, protected by the configMutex of the
+	// server
+	settings map[string]json.RawMessage
+}
+
+type sessionRegistry struct {
+	mutex      sync.Mutex
+	controller inputcontrol.Controller
+	sessions   map[*session]struct{}
+	tokens     map[string]*session
+	timeout    time.Duration
+	policy     string
+	maxClients int
+	closed     bool
+}
+
+func newSessionRegistry(controller inputcontrol.Controller, timeout time.Duration) *sessionRegistry {
+	return &sessionRegistry{
+		controller: controller,
+		sessions:   make(map[*session]struct{}),
+		tokens:     make(map[string]*session),
+		timeout:    timeout,
+		policy:     policyShared,
+	}
+}
+
+// attach connects the client to the session with the resume token or to a new
+// session. A client that is still connected to the session gets disconnected.
+// Sessions that wait for resumption count towards the client limits.
+func (r *sessionRegistry) attach(c *client, cred *credential, token string) (*session, bool, error) {
+	var takenOver []*client
+	defer func() {
+		for _, other := range takenOver {
+			other.sendError(errorTakenOver, errors.New("another client took over"), true)
+			other.ws.Close()
+		}
+	}()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	sess, resumed := r.tokens[token]
+	if resumed && sess.credential != cred {
+		sess, resumed = nil, false
+	}
+	if resumed {
+		delete(r.tokens, token)
+		if sess.expiry != nil {
+			sess.expiry.Stop()
+			sess.expiry = nil
+		}
+		if sess.client != nil {
+			sess.client.ws.Close()
+		}
+	} else {
+		switch {
+		case r.policy == policyExclusive && len(r.sessions) > 0:
+			return nil, false, errBusy
+		case r.policy == policyTakeover:
+			for other := range r.sessions {
+				if other.client != nil {
+					takenOver = append(takenOver, other.client)
+				}
+				r.endLocked(other)
+			}
+		}
+		if r.maxClients > 0 && len(r.sessions) >= r.maxClients {
+			return nil, false, &tooManyClientsError{r.maxClients}
+		}
+		sess = &session{credential: cred, controller: newTrackingController(r.controller)}
+		if r.closed {
+			sess.controller.Close()
+		} else {
+			r.sessions[sess] = struct{}{}
+		}
+	}
+	sess.client = c
+	sess.token = ""
+	if c.hasFeature(featureResume) && r.timeout > 0 && !r.closed {
+		sess.token = secureRandBase64(resumeTokenLength)
+		r.tokens[sess.token] = sess
+	}
+	return sess, resumed, nil
+}
+
+// detach disconnects the client from the session. The session ends unless it
+// can be resumed.
+func (r *sessionRegistry) detach(sess *session, c *client) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if sess.client != c {
+		// Another client took over the session
+		return
+	}
+	sess.client = nil
+	if sess.token == "" {
+		r.endLocked(sess)
+		return
+	}
+	sess.expiry = time.AfterFunc(r.timeout, func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if sess.client == nil && r.tokens[sess.token] == sess {
+			log.Print("Session expired")
+			r.endLocked(sess)
+		}
+	})
+}
+
+func (r *sessionRegistry) endLocked(sess *session) {
+	if sess.token != "" {
+		delete(r.tokens, sess.token)
+		sess.token = ""
+	}
+	if sess.expiry != nil {
+		sess.expiry.Stop()
+		sess.expiry = nil
+	}
+	delete(r.sessions, sess)
+	if err := sess.controller.Close(); err != nil {
+		log.Printf("Failed to release pointer buttons: %v", err)
+	}
+}
+
+// clients returns the connected clients.
+func (r *sessionRegistry) clients() []*client {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var clients []*client
+	for sess := range r.sessions {
+		if sess.client != nil {
+			clients = append(clients, sess.client)
+		}
+	}
+	return clients
+}
+
+// closeAll ends all sessions and disconnects their clients.
+func (r *sessionRegistry) closeAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+	for sess := range r.sessions {
+		if sess.client != nil {
+			sess.client.ws.Close()
+		}
+		r.endLocked(sess)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/unrud/remote-touchpad/inputcontrol"
+)
+
+const (
+	defaultSmoothingLatency time.Duration = 33 * time.Millisecond
+	maxSmoothingRate        uint          = 1000
+	maxSmoothingLatency     time.Duration = time.Second
+)
+
+// smoothingController splits pointer movements into evenly spaced steps, that
+// are applied at the output rate over the latency. Clients send movements in
+// bursts with their update rate, which look choppy on screens with higher
+// refresh rates. Pending movements are applied immediately before all other
+// input, so that it hits the expected position and keeps its order.
+type smoothingController struct {
+	inputcontrol.Controller
+	interval time.Duration
+
+	mutex sync.Mutex
+	// Movement of the upcoming steps
+	steps   [][2]int
+	running bool
+	closed  bool
+}
+
+func newSmoothingController(controller inputcontrol.Controller, rate uint, latency time.Duration) *smoothingController {
+	interval := time.Second / time.Duration(rate)
+	return &smoothingController{
+		Controller: controller,
+		interval:   interval,
+		// The last step is applied within the latency
+		steps: make([][2]int, max(1, int(latency/interval))),
+	}
+}
+
+func (p *smoothingController) PointerMove(deltaX, deltaY int) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return p.Controller.PointerMove(deltaX, deltaY)
+	}
+	for i := range p.steps {
+		p.steps[i][0] = addSaturated(p.steps[i][0], splitDelta(deltaX, len(p.steps), i))
+		p.steps[i][1] = addSaturated(p.steps[i][1], splitDelta(deltaY, len(p.steps), i))
+	}
+	if !p.running {
+		p.running = true
+		go p.run()
+	}
+	return nil
+}
+
+// splitDelta returns the part of the delta for step i of n. The parts add up
+// to the delta. The delta isn't multiplied, because it's sent by the client
+// and could overflow.
+func splitDelta(delta, n, i int) int {
+	quotient, remainder := delta/n, delta%n
+	return quotient + remainder*(i+1)/n - remainder*i/n
+}
+
+// addSaturated adds without overflowing, huge movements are clamped.
+func addSaturated(a, b int) int {
+	if b > 0 && a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	if b < 0 && a < math.MinInt-b {
+		return math.MinInt
+	}
+	return a + b
+}
+
+// run applies the steps until no movement is left.
+func (p *smoothingController) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.mutex.Lock()
+		if !p.stepLocked() {
+			p.running = false
+			p.mutex.Unlock()
+			return
+		}
+		p.mutex.Unlock()
+		<-ticker.C
+	}
+}
+
+// stepLocked applies the next step and reports whether movement is pending.
+func (p *smoothingController) stepLocked() bool {
+	step := p.steps[0]
+	copy(p.steps, p.steps[1:])
+	p.steps[len(p.steps)-1] = [2]int{}
+	if step != [2]int{} {
+		// The session that queued the movement might be gone
+		if err := p.Controller.PointerMove(step[0], step[1]); err != nil {
+			log.Printf("Failed to apply smoothed movement: %v", err)
+		}
+	}
+	for _, step := range p.steps {
+		if step != [2]int{} {
+			return true
+		}
+	}
+	return false
+}
+
+// flushLocked applies all pending movement at once.
+func (p *smoothingController) flushLocked() error {
+	var sum [2]int
+	for i, step := range p.steps {
+		sum[0] = addSaturated(sum[0], step[0])
+		sum[1] = addSaturated(sum[1], step[1])
+		p.steps[i] = [2]int{}
+	}
+	if sum != [2]int{} {
+		return p.Controller.PointerMove(sum[0], sum[1])
+	}
+	return nil
+}
+
+func (p *smoothingController) KeyboardText(text string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err := p.flushLocked(); err != nil {
+		return err
+	}
+	return p.Controller.KeyboardText(text)
+}
+
+func (p *smoothingController) KeyboardKey(key inputcontrol.Key) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err := p.flushLocked(); err != nil {
+		return err
+	}
+	return p.Controller.KeyboardKey(key)
+}
+
+func (p *smoothingController) PointerButton(button inputcontrol.PointerButton, press bool) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err := p.flushLocked(); err != nil {
+		return err
+	}
+	return p.Controller.PointerButton(button, press)
+}
+
+func (p *smoothingController) PointerScroll(deltaHorizontal, deltaVertical int, finish bool) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err := p.flushLocked(); err != nil {
+		return err
+	}
+	return p.Controller.PointerScroll(deltaHorizontal, deltaVertical, finish)
+}
+
+// Close applies the pending movement and closes the wrapped controller.
+// Later movements are applied immediately.
+func (p *smoothingController) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	flushErr := p.flushLocked()
+	if err := p.Controller.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
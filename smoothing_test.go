@@ -0,0 +1,61 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSmoothingController(t *testing.T) {
+	recorder := &recordingController{}
+	controller := newSmoothingController(recorder, 1000, 4*time.Millisecond)
+	if err := controller.PointerMove(10, -7); err != nil {
+		t.Fatal(err)
+	}
+	waitForCalls(t, recorder, "move 2 -1", "move 3 -2", "move 2 -2", "move 3 -2")
+}
+
+func TestSmoothingControllerOverflow(t *testing.T) {
+	recorder := &recordingController{}
+	controller := newSmoothingController(recorder, 1000, 4*time.Millisecond)
+	controller.PointerMove(math.MaxInt, math.MinInt)
+	x, y := math.MaxInt/4, math.MinInt/4
+	waitForCalls(t, recorder, fmt.Sprintf("move %d %d", x, y), fmt.Sprintf("move %d %d", x+1, y),
+		fmt.Sprintf("move %d %d", x+1, y), fmt.Sprintf("move %d %d", x+1, y))
+}
+
+func TestSmoothingControllerFlush(t *testing.T) {
+	recorder := &recordingController{}
+	controller := newSmoothingController(recorder, 10, time.Second)
+	controller.PointerMove(5, 0)
+	// Wait for the first movement, the steps are 100 ms apart
+	for len(recorder.Calls()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	controller.PointerButton(1, true)
+	controller.PointerMove(0, 2)
+	controller.KeyboardKey(3)
+	controller.Close()
+	controller.PointerMove(1, 1)
+	waitForCalls(t, recorder, "move 1 0", "move 4 0", "button 1 true", "move 0 2", "key 3", "move 1 1")
+}
@@ -0,0 +1,130 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/unrud/remote-touchpad/inputcontrol"
+)
+
+var errControllerClosed = errors.New("controller closed")
+
+// trackingController records the pointer buttons pressed through it, so they
+// can be released when the client goes away. Keys are pressed and released
+// within a single KeyboardKey or KeyboardText call by all controllers and
+// can't stay pressed.
+//
+// Close releases the pressed buttons, but doesn't close the wrapped
+// controller, which is shared by all sessions.
+type trackingController struct {
+	controller inputcontrol.Controller
+	mutex      sync.Mutex
+	pressed    [inputcontrol.PointerButtonLimit]bool
+	closed     bool
+}
+
+func newTrackingController(controller inputcontrol.Controller) *trackingController {
+	return &trackingController{controller: controller}
+}
+
+// Release releases all pressed buttons.
+func (p *trackingController) Release() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.releaseLocked()
+}
+
+func (p *trackingController) releaseLocked() error {
+	var errs []error
+	for button, pressed := range p.pressed {
+		if !pressed {
+			continue
+		}
+		if err := p.controller.PointerButton(inputcontrol.PointerButton(button), false); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		p.pressed[button] = false
+	}
+	return errors.Join(errs...)
+}
+
+func (p *trackingController) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	return p.releaseLocked()
+}
+
+func (p *trackingController) KeyboardText(text string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return errControllerClosed
+	}
+	return p.controller.KeyboardText(text)
+}
+
+func (p *trackingController) KeyboardKey(key inputcontrol.Key) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return errControllerClosed
+	}
+	return p.controller.KeyboardKey(key)
+}
+
+func (p *trackingController) PointerButton(button inputcontrol.PointerButton, press bool) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return errControllerClosed
+	}
+	if err := p.controller.PointerButton(button, press); err != nil {
+		return err
+	}
+	if button >= 0 && button < inputcontrol.PointerButtonLimit {
+		p.pressed[button] = press
+	}
+	return nil
+}
+
+func (p *trackingController) PointerMove(deltaX, deltaY int) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return errControllerClosed
+	}
+	return p.controller.PointerMove(deltaX, deltaY)
+}
+
+func (p *trackingController) PointerScroll(deltaHorizontal, deltaVertical int, finish bool) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return errControllerClosed
+	}
+	return p.controller.PointerScroll(deltaHorizontal, deltaVertical, finish)
+}
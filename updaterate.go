@@ -0,0 +1,91 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import "time"
+
+const (
+	defaultMinUpdateRate uint = 10
+	defaultMaxUpdateRate uint = 120
+)
+
+const (
+	// Minimum time between changes of the update rate
+	updateRateHoldTime time.Duration = 500 * time.Millisecond
+	// The rate is reduced quickly and raised slowly
+	updateRateDecrease float64 = 0.75
+	updateRateIncrease uint    = 5
+	// Messages that arrive without waiting were queued
+	queuedMessageWait time.Duration = time.Millisecond
+	maxQueueDepth     int           = 2
+	// Share of the update interval that is spent handling an update
+	highUpdateLoad float64 = 0.5
+	lowUpdateLoad  float64 = 0.25
+)
+
+// updateRateController adapts the update rate of a client to the backpressure.
+// The rate is lowered when updates queue up or their handling takes a large
+// share of the update interval, e.g. with slow controllers or networks, and
+// raised while the server keeps up easily. It must be reset with the update
+// rate of every config that is sent to the client and is only used by the
+// goroutine that handles the messages of the client.
+type updateRateController struct {
+	min uint
+	max uint
+	// Update rate of the config, that the client falls back to with every
+	// new config
+	base       uint
+	rate       uint
+	handling   movingAverage
+	queueDepth int
+	changed    time.Time
+}
+
+// reset starts over at the update rate of a new config.
+func (r *updateRateController) reset(configRate uint, now time.Time) {
+	*r = updateRateController{min: r.min, max: r.max, base: configRate, rate: configRate, changed: now}
+}
+
+// observe records the handling of an update and the time that the server
+// waited for it. It returns the new rate, if the rate changed.
+func (r *updateRateController) observe(handling, waited time.Duration, now time.Time) (uint, bool) {
+	r.handling.add(handling)
+	if waited < queuedMessageWait {
+		r.queueDepth++
+	} else {
+		r.queueDepth = 0
+	}
+	if now.Sub(r.changed) < updateRateHoldTime {
+		return r.rate, false
+	}
+	load := float64(r.handling.value) / float64(time.Second/time.Duration(r.rate))
+	rate := r.rate
+	if r.queueDepth >= maxQueueDepth || load > highUpdateLoad {
+		rate = max(min(r.min, r.base), uint(float64(r.rate)*updateRateDecrease))
+	} else if load < lowUpdateLoad {
+		rate = min(max(r.max, r.base), r.rate+updateRateIncrease)
+	}
+	if rate == r.rate {
+		return r.rate, false
+	}
+	r.rate = rate
+	r.changed = now
+	return rate, true
+}
@@ -0,0 +1,73 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateRateController(t *testing.T) {
+	r := updateRateController{min: 10, max: 40}
+	now := time.Now()
+	observe := func(handling, waited time.Duration) (uint, bool) {
+		now = now.Add(updateRateHoldTime)
+		return r.observe(handling, waited, now)
+	}
+	// Starts at the rate of the config
+	r.reset(30, now)
+	if rate, changed := r.observe(0, time.Second, now); rate != 30 || changed {
+		t.Fatalf("unexpected rate: %d (%t)", rate, changed)
+	}
+	// Fast handling raises the rate up to the maximum
+	for _, expected := range []uint{35, 40, 40} {
+		if rate, _ := observe(time.Millisecond, 30*time.Millisecond); rate != expected {
+			t.Fatalf("unexpected rate: %d, expected %d", rate, expected)
+		}
+	}
+	// Queued updates lower the rate
+	observe(time.Millisecond, 0)
+	if rate, changed := observe(time.Millisecond, 0); rate != 30 || !changed {
+		t.Fatalf("unexpected rate: %d (%t)", rate, changed)
+	}
+	// Slow handling lowers the rate down to the minimum
+	for _, expected := range []uint{22, 16, 12, 10, 10} {
+		if rate, _ := observe(500*time.Millisecond, 30*time.Millisecond); rate != expected {
+			t.Fatalf("unexpected rate: %d, expected %d", rate, expected)
+		}
+	}
+	// A new config resets the rate, even if its rate is unchanged
+	r.reset(30, now)
+	if rate, changed := r.observe(500*time.Millisecond, 30*time.Millisecond, now); rate != 30 || changed {
+		t.Fatalf("unexpected rate: %d (%t)", rate, changed)
+	}
+}
+
+func TestUpdateRateControllerHoldTime(t *testing.T) {
+	r := updateRateController{min: 10, max: 40}
+	now := time.Now()
+	r.reset(30, now)
+	for range 9 {
+		now = now.Add(updateRateHoldTime / 10)
+		if _, changed := r.observe(0, 0, now); changed {
+			t.Fatal("rate changed within hold time")
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// configOverrides replace values of the config for a user. Values that aren't
+// set are taken from the global config, so that they follow reloads.
+type configOverrides struct {
+	UpdateRate            *uint                `json:"update-rate,omitempty"`
+	MoveSpeed             *float64             `json:"move-speed,omitempty"`
+	ScrollSpeed           *float64             `json:"scroll-speed,omitempty"`
+	MouseMoveSpeed        *float64             `json:"mouse-move-speed,omitempty"`
+	MouseScrollSpeed      *float64             `json:"mouse-scroll-speed,omitempty"`
+	Acceleration          *accelerationProfile `json:"acceleration,omitempty"`
+	TouchMoveThreshold    *touchMoveThreshold  `json:"touch-move-threshold,omitempty"`
+	TouchTimeout          *milliseconds        `json:"touch-timeout,omitempty"`
+	TapToDrag             *bool                `json:"tap-to-drag,omitempty"`
+	NaturalScrolling      *bool                `json:"natural-scrolling,omitempty"`
+	MouseNaturalScrolling *bool                `json:"mouse-natural-scrolling,omitempty"`
+	ScrollAxisLock        *bool                `json:"scroll-axis-lock,omitempty"`
+}
+
+func (o configOverrides) apply(c config) config {
+	if o.UpdateRate != nil {
+		c.UpdateRate = *o.UpdateRate
+	}
+	if o.MoveSpeed != nil {
+		c.MoveSpeed = *o.MoveSpeed
+	}
+	if o.ScrollSpeed != nil {
+		c.ScrollSpeed = *o.ScrollSpeed
+	}
+	if o.MouseMoveSpeed != nil {
+		c.MouseMoveSpeed = *o.MouseMoveSpeed
+	}
+	if o.MouseScrollSpeed != nil {
+		c.MouseScrollSpeed = *o.MouseScrollSpeed
+	}
+	if o.Acceleration != nil {
+		c.Acceleration = *o.Acceleration
+	}
+	if o.TouchMoveThreshold != nil {
+		c.TouchMoveThreshold = *o.TouchMoveThreshold
+	}
+	if o.TouchTimeout != nil {
+		c.TouchTimeout = *o.TouchTimeout
+	}
+	if o.TapToDrag != nil {
+		c.TapToDrag = *o.TapToDrag
+	}
+	if o.NaturalScrolling != nil {
+		c.NaturalScrolling = *o.NaturalScrolling
+	}
+	if o.MouseNaturalScrolling != nil {
+		c.MouseNaturalScrolling = *o.MouseNaturalScrolling
+	}
+	if o.ScrollAxisLock != nil {
+		c.ScrollAxisLock = *o.ScrollAxisLock
+	}
+	return c
+}
+
+// userOptions is the JSON object of a user in the options. The keys of the
+// config are the names of the corresponding options.
+type userOptions struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+	Scopes string `json:"scopes"`
+	configOverrides
+}
+
+// parseUser parses the JSON object of a user. Users get all scopes and a
+// random secret by default.
+func parseUser(value string) (*credential, configOverrides, error) {
+	var u userOptions
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&u); err != nil {
+		return nil, configOverrides{}, err
+	}
+	if u.Name == "" {
+		return nil, configOverrides{}, errors.New("name missing")
+	}
+	scopes := allScopes
+	if u.Scopes != "" {
+		var err error
+		if scopes, err = parseScopes(u.Scopes); err != nil {
+			return nil, configOverrides{}, err
+		}
+	}
+	if u.UpdateRate != nil && *u.UpdateRate == 0 {
+		return nil, configOverrides{}, errors.New("update-rate: must be positive")
+	}
+	if u.TouchTimeout != nil && *u.TouchTimeout <= 0 {
+		return nil, configOverrides{}, errors.New("touch-timeout: must be positive")
+	}
+	secret := u.Secret
+	if secret == "" {
+		secret = secureRandBase64(defaultSecretLength)
+	}
+	return &credential{secret: secret, scopes: scopes, user: u.Name}, u.configOverrides, nil
+}
@@ -0,0 +1,142 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+import jsSHA from "./sha256.mjs"
+
+// Encryption of WebSocket messages, compatible with the server. Messages are
+// encrypted with a keystream of HMAC-SHA256 blocks in counter mode and
+// authenticated with HMAC-SHA256 (encrypt-then-MAC). WebCrypto can't be used,
+// because it's only available in secure contexts.
+const ENCRYPTION_INFO = "remote-touchpad encryption v1";
+const KEY_LENGTH = 32;
+const TAG_LENGTH = 32;
+
+const textEncoder = new TextEncoder();
+const textDecoder = new TextDecoder("utf-8", {fatal: true});
+
+export const hmac = (key, ...data) => {
+    const shaObj = new jsSHA("SHA-256", "UINT8ARRAY");
+    shaObj.setHMACKey(key, "UINT8ARRAY");
+    for (const part of data) {
+        shaObj.update(part);
+    }
+    return shaObj.getHMAC("UINT8ARRAY");
+};
+
+// HKDF with SHA-256 (RFC 5869)
+export const hkdf = (secret, salt, info, length) => {
+    const prk = hmac(salt, secret);
+    const result = new Uint8Array(length);
+    let block = new Uint8Array(0);
+    for (let i = 0; i * KEY_LENGTH < length; i += 1) {
+        block = hmac(prk, block, textEncoder.encode(info), new Uint8Array([i + 1]));
+        result.set(block.subarray(0, length - i * KEY_LENGTH), i * KEY_LENGTH);
+    }
+    return result;
+};
+
+const uint64 = (value) => {
+    const bytes = new Uint8Array(8);
+    const view = new DataView(bytes.buffer);
+    view.setUint32(0, Math.floor(value / 0x100000000));
+    view.setUint32(4, value % 0x100000000);
+    return bytes;
+};
+
+export const toBase64 = (bytes) => {
+    let binary = "";
+    for (const byte of bytes) {
+        binary += String.fromCharCode(byte);
+    }
+    return btoa(binary);
+};
+
+export const fromBase64 = (value) => Uint8Array.from(atob(value), (c) => c.charCodeAt(0));
+
+class CipherState {
+    #encryptionKey;
+    #macKey;
+    sequence = 0;
+
+    constructor(encryptionKey, macKey) {
+        this.#encryptionKey = encryptionKey;
+        this.#macKey = macKey;
+    }
+
+    keystreamXOR(data) {
+        const result = new Uint8Array(data.length);
+        const block = new Uint8Array(12);
+        block.set(uint64(this.sequence));
+        const view = new DataView(block.buffer);
+        for (let i = 0; i < data.length; i += KEY_LENGTH) {
+            view.setUint32(8, i / KEY_LENGTH);
+            const keystream = hmac(this.#encryptionKey, block);
+            for (let j = i; j < data.length && j - i < KEY_LENGTH; j += 1) {
+                result[j] = data[j] ^ keystream[j - i];
+            }
+        }
+        return result;
+    }
+
+    tag(ciphertext) {
+        return hmac(this.#macKey, uint64(this.sequence), ciphertext);
+    }
+}
+
+export default class MessageCipher {
+    #send;
+    #receive;
+
+    constructor(secret, challenge) {
+        const keys = hkdf(textEncoder.encode(secret), textEncoder.encode(challenge),
+            ENCRYPTION_INFO, 4 * KEY_LENGTH);
+        const key = (i) => keys.subarray(i * KEY_LENGTH, (i + 1) * KEY_LENGTH);
+        this.#send = new CipherState(key(0), key(1));
+        this.#receive = new CipherState(key(2), key(3));
+    }
+
+    seal(text) {
+        const ciphertext = this.#send.keystreamXOR(textEncoder.encode(text));
+        const sealed = new Uint8Array(ciphertext.length + TAG_LENGTH);
+        sealed.set(ciphertext);
+        sealed.set(this.#send.tag(ciphertext), ciphertext.length);
+        this.#send.sequence += 1;
+        return toBase64(sealed);
+    }
+
+    open(message) {
+        const sealed = fromBase64(message);
+        if (sealed.length < TAG_LENGTH) {
+            throw new Error("message authentication failed");
+        }
+        const ciphertext = sealed.subarray(0, sealed.length - TAG_LENGTH);
+        const tag = sealed.subarray(sealed.length - TAG_LENGTH);
+        const expectedTag = this.#receive.tag(ciphertext);
+        let difference = 0;
+        for (let i = 0; i < TAG_LENGTH; i += 1) {
+            difference |= tag[i] ^ expectedTag[i];
+        }
+        if (difference != 0) {
+            throw new Error("message authentication failed");
+        }
+        const plaintext = this.#receive.keystreamXOR(ciphertext);
+        this.#receive.sequence += 1;
+        return textDecoder.decode(plaintext);
+    }
+}
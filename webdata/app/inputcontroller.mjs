@@ -49,6 +49,8 @@ export default class InputController {
     #scrollVSum = 0;
     #scrolling = false;
     #scrollFinish = false;
+    // The touchpad and the mouse aren't used at the same time
+    #scrollWheel = false;
     #updateTimeoutActive = false;
     #socket;
 
@@ -60,16 +62,32 @@ export default class InputController {
         this.#updateRate = config.updateRate;
     }
 
+    // The server adapts the update rate to the load until the next config
+    setUpdateRate(updateRate) {
+        this.#updateRate = updateRate;
+    }
+
+    #sendCommands(commands) {
+        if (commands.length > 1 && this.#socket.features.includes("batch")) {
+            this.#socket.send({type: "batch", commands: commands});
+            return;
+        }
+        for (const command of commands) {
+            this.#socket.send(command);
+        }
+    }
+
     #startUpdate(fromTimeout) {
         if (this.#updateTimeoutActive && !fromTimeout) {
             return;
         }
         this.#updateTimeoutActive = false;
         let finished = true;
+        const commands = [];
         const xInt = Math.trunc(this.#moveXSum);
         const yInt = Math.trunc(this.#moveYSum);
         if (xInt != 0 || yInt != 0) {
-            this.#socket.send("m" + xInt + ";" + yInt);
+            commands.push({type: "move", x: xInt, y: yInt});
             this.#moveXSum -= xInt;
             this.#moveYSum -= yInt;
             finished = false;
@@ -77,17 +95,20 @@ export default class InputController {
         const hInt = Math.trunc(this.#scrollHSum);
         const vInt = Math.trunc(this.#scrollVSum);
         if (hInt != 0 || vInt != 0) {
-            this.#socket.send((this.#scrollFinish ? "S" : "s") + hInt + ";" + vInt);
+            commands.push({
+                type: "scroll", x: hInt, y: vInt, finish: Boolean(this.#scrollFinish), wheel: this.#scrollWheel,
+            });
             this.#scrollHSum -= hInt;
             this.#scrollVSum -= vInt;
             this.#scrolling = !this.#scrollFinish;
             this.#scrollFinish = false;
             finished = false;
         } else if (this.#scrollFinish && this.#scrolling) {
-            this.#socket.send("S");
+            commands.push({type: "scroll", x: 0, y: 0, finish: true, wheel: this.#scrollWheel});
             this.#scrolling = false;
             this.#scrollFinish = false;
         }
+        this.#sendCommands(commands);
         this.#updateTimeoutActive = !finished && this.#updateRate > 0;
         if (this.#updateTimeoutActive) {
             setTimeout(this.#startUpdate.bind(this), 1000 / this.#updateRate, true);
@@ -100,22 +121,41 @@ export default class InputController {
         this.#startUpdate();
     }
 
-    pointerScroll(deltaHorizontal, deltaVertical, finish) {
+    pointerScroll(deltaHorizontal, deltaVertical, finish, wheel) {
         this.#scrollHSum += deltaHorizontal;
         this.#scrollVSum += deltaVertical;
         this.#scrollFinish |= finish;
+        this.#scrollWheel = Boolean(wheel);
         this.#startUpdate();
     };
 
     pointerButton(button, press) {
-        this.#socket.send("b" + button + ";" + (press ? 1 : 0));
+        this.#socket.send({type: "button", button: button, press: Boolean(press)});
     }
 
     keyboardKey(key) {
-        this.#socket.send("k" + key);
+        this.#socket.send({type: "key", key: key});
     }
 
     keyboardText(text) {
-        this.#socket.send("t" + text);
+        this.#socket.send({type: "text", text: text});
+    }
+
+    get settingsAllowed() {
+        return this.#socket.scopes.includes("settings");
+    }
+
+    get pairingAvailable() {
+        return this.#socket.pairingAvailable;
+    }
+
+    // Pairs the device, that authenticates with its own token afterwards
+    pair() {
+        this.#socket.pair();
+    }
+
+    // Changes values of the config. The server answers with the new config.
+    changeSettings(config, reset = false) {
+        this.#socket.send({type: "settings", config: config, reset: reset});
     }
 }
@@ -24,9 +24,23 @@ import UI from "./ui.mjs";
 const url = new URL("ws", location.href);
 url.protocol = url.protocol == "http:" ? "ws:" : "wss:";
 
-const socket = new Socket(url, window.location.hash.substr(1));
+// The URL fragment contains the secret and the optional fingerprint of the
+// TLS certificate
+const FINGERPRINT_PREFIX = "~sha256:";
+let secret = window.location.hash.substr(1);
+let fingerprint = "";
+const fingerprintIndex = secret.lastIndexOf(FINGERPRINT_PREFIX);
+if (fingerprintIndex >= 0) {
+    fingerprint = secret.substr(fingerprintIndex + FINGERPRINT_PREFIX.length);
+    secret = secret.substr(0, fingerprintIndex);
+}
+
+const socket = new Socket(url, secret, (reason) => ui.requestPIN(reason));
 const inputController = new InputController(socket);
 const ui = new UI(inputController);
+if (fingerprint) {
+    ui.showFingerprint(fingerprint);
+}
 
 socket.addEventListener("config", (event) => {
     const config = event.detail;
@@ -34,16 +48,41 @@ socket.addEventListener("config", (event) => {
     ui.configure(config);
 });
 
-socket.addEventListener("close", () => {
-    ui.close();
+socket.addEventListener("rate", (event) => {
+    inputController.setUpdateRate(event.detail);
+});
+
+socket.addEventListener("stats", (event) => {
+    ui.showStats(event.detail);
+});
+
+socket.addEventListener("paired", () => {
+    ui.paired();
 });
 
+socket.addEventListener("error", (event) => {
+    ui.showToast(event.detail.message);
+});
+
+socket.addEventListener("reconnecting", () => {
+    ui.showToast("Reconnecting…");
+});
+
+socket.addEventListener("close", (event) => {
+    ui.close(event.detail);
+});
+
+socket.connect();
+
 window.app = {
     key: inputController.keyboardKey.bind(inputController),
     text: inputController.keyboardText.bind(inputController),
     toggleFullscreen: ui.toggleFullscreen.bind(ui),
     showTextInput: ui.showTextInput.bind(ui),
     showKeys: ui.showKeys.bind(ui),
+    showSettings: ui.showSettings.bind(ui),
+    resetSettings: ui.resetSettings.bind(ui),
+    pair: ui.pair.bind(ui),
     setKeysPage: ui.setKeysPage.bind(ui),
 };
 for (const name in inputcontrollerModule) {
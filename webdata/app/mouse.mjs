@@ -64,11 +64,11 @@ export default class Mouse {
     #handleWheel(event) {
         if (event.deltaMode == WheelEvent.DOM_DELTA_PIXEL) {
             this.#inputController.pointerScroll(
-                event.deltaX * this.#scrollSpeed, event.deltaY * this.#scrollSpeed, true);
+                event.deltaX * this.#scrollSpeed, event.deltaY * this.#scrollSpeed, true, true);
         } else if (event.deltaMode == WheelEvent.DOM_DELTA_LINE) {
             this.#inputController.pointerScroll(
                 event.deltaX * 20 * this.#scrollSpeed, event.deltaY * 20 * this.#scrollSpeed,
-                true);
+                true, true);
         }
     }
 }
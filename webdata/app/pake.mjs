@@ -0,0 +1,134 @@
+/*
+ *    Copyright (c) 2026 Unrud <unrud@outlook.com>
+ *
+ *    This file is part of Remote-Touchpad.
+ *
+ *    Remote-Touchpad is free software: you can redistribute it and/or modify
+ *    it under the terms of the GNU General Public License as published by
+ *    the Free Software Foundation, either version 3 of the License, or
+ *    (at your option) any later version.
+ *
+ *    Remote-Touchpad is distributed in the hope that it will be useful,
+ *    but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *    GNU General Public License for more details.
+ *
+ *    You should have received a copy of the GNU General Public License
+ *    along with Remote-Touchpad.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+import jsSHA from "./sha256.mjs"
+import {hkdf, toBase64, fromBase64} from "./encryption.mjs";
+
+// Client side of the key exchange for PIN pairing, compatible with the
+// server. SPAKE2 in the 2048-bit MODP group from RFC 3526.
+const PAKE_INFO = "remote-touchpad pake v1";
+const ELEMENT_LENGTH = 256; // bytes
+const KEY_LENGTH = 32; // bytes
+const PRIME = BigInt("0x" +
+    "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22" +
+    "514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6" +
+    "F44C42E9A637ED6B0BFF5CB6F406B7EDEE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+    "C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+    "9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3BE39E772C180E8603" +
+    "9B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+    "15728E5A8AACAA68FFFFFFFFFFFFFFFF");
+const ORDER = PRIME >> 1n;
+const GENERATOR = 2n;
+
+const textEncoder = new TextEncoder();
+
+const sha256 = (...data) => {
+    const shaObj = new jsSHA("SHA-256", "UINT8ARRAY");
+    for (const part of data) {
+        shaObj.update(part);
+    }
+    return shaObj.getHash("UINT8ARRAY");
+};
+
+const modPow = (base, exponent, modulus) => {
+    let result = 1n;
+    base %= modulus;
+    for (; exponent > 0n; exponent >>= 1n) {
+        if (exponent & 1n) {
+            result = result * base % modulus;
+        }
+        base = base * base % modulus;
+    }
+    return result;
+};
+
+const toBigInt = (bytes) => {
+    let value = 0n;
+    for (const byte of bytes) {
+        value = (value << 8n) | BigInt(byte);
+    }
+    return value;
+};
+
+const fromBigInt = (value) => {
+    const bytes = new Uint8Array(ELEMENT_LENGTH);
+    for (let i = ELEMENT_LENGTH - 1; i >= 0; i -= 1) {
+        bytes[i] = Number(value & 0xffn);
+        value >>= 8n;
+    }
+    return bytes;
+};
+
+const hashToGroup = (label) => {
+    const digest = new Uint8Array(ELEMENT_LENGTH + KEY_LENGTH);
+    for (let i = 0; i * KEY_LENGTH < digest.length; i += 1) {
+        digest.set(sha256(textEncoder.encode(label), new Uint8Array([i])), i * KEY_LENGTH);
+    }
+    const x = toBigInt(digest) % PRIME;
+    return x * x % PRIME;
+};
+
+const M = hashToGroup("remote-touchpad pake M");
+const N = hashToGroup("remote-touchpad pake N");
+
+const password = (pin) => toBigInt(sha256(textEncoder.encode(pin)));
+
+export default class PAKE {
+    #pin;
+    #x;
+    #element;
+
+    constructor(pin) {
+        this.#pin = pin;
+        // Additional bytes make the bias of the reduction negligible
+        const random = new Uint8Array(ELEMENT_LENGTH + KEY_LENGTH);
+        crypto.getRandomValues(random);
+        this.#x = toBigInt(random) % ORDER;
+        this.#element = modPow(GENERATOR, this.#x, PRIME) * modPow(M, password(pin), PRIME) % PRIME;
+    }
+
+    get element() {
+        return toBase64(fromBigInt(this.#element));
+    }
+
+    // Returns the secret for the encryption of the connection and the
+    // confirmation for the server
+    finish(challenge, element) {
+        const bytes = fromBase64(element);
+        const serverElement = toBigInt(bytes);
+        if (bytes.length != ELEMENT_LENGTH || serverElement <= 1n || serverElement >= PRIME - 1n ||
+            modPow(serverElement, ORDER, PRIME) != 1n) {
+            throw new Error("invalid PAKE element");
+        }
+        // The inverse of N^w is N^(q-w), because the order of N is q
+        const shared = modPow(modPow(N, ORDER - password(this.#pin), PRIME) * serverElement % PRIME,
+            this.#x, PRIME);
+        const pin = textEncoder.encode(this.#pin);
+        const transcript = new Uint8Array(3 * ELEMENT_LENGTH + pin.length);
+        transcript.set(fromBigInt(this.#element));
+        transcript.set(fromBigInt(serverElement), ELEMENT_LENGTH);
+        transcript.set(fromBigInt(shared), 2 * ELEMENT_LENGTH);
+        transcript.set(pin, 3 * ELEMENT_LENGTH);
+        const keys = hkdf(transcript, textEncoder.encode(challenge), PAKE_INFO, 2 * KEY_LENGTH);
+        return {
+            secret: toBase64(keys.subarray(0, KEY_LENGTH)),
+            confirmation: toBase64(keys.subarray(KEY_LENGTH)),
+        };
+    }
+}
@@ -18,49 +18,300 @@
  */
 
 import jsSHA from "./sha256.mjs"
+import MessageCipher from "./encryption.mjs"
+import PAKE from "./pake.mjs"
 
-const challengeResponse = (message, secret) => {
+// The request for encryption is authenticated, so that it can't be removed
+const challengeResponse = (message, secret, encryption) => {
     const shaObj = new jsSHA("SHA-256", "TEXT");
-    shaObj.setHMACKey(message, "TEXT");
-    shaObj.update(secret);
-    return btoa(shaObj.getHMAC("BYTES"));
+    shaObj.setHMACKey(secret, "TEXT");
+    shaObj.update(encryption ? message + ":encryption" : message);
+    return shaObj.getHMAC("B64");
 };
 
+const AUTH_SCHEME = 2;
+const AUTH_SCHEME_PIN = 3;
+const AUTH_SCHEME_CERTIFICATE = 4;
+const PROTOCOL_VERSIONS = [2];
+const PROTOCOL_FEATURES = ["batch", "heartbeat", "resume", "pairing", "latency", "adaptive-rate"];
+const DEVICE_STORAGE_KEY = "device";
+const MAX_DEVICE_NAME = 100;
+
+const loadDevice = () => {
+    try {
+        const device = JSON.parse(localStorage.getItem(DEVICE_STORAGE_KEY));
+        if (device && device.id && device.token) {
+            return device;
+        }
+    } catch (e) {
+        // Storage is unavailable or corrupted
+    }
+    return null;
+};
+
+const storeDevice = (device) => {
+    try {
+        if (device) {
+            localStorage.setItem(DEVICE_STORAGE_KEY, JSON.stringify(device));
+        } else {
+            localStorage.removeItem(DEVICE_STORAGE_KEY);
+        }
+    } catch (e) {
+        // Storage is unavailable
+    }
+};
+const RECONNECT_DELAY = 1000; // milliseconds
+const MAX_PENDING_MESSAGES = 100;
+
 export default class Socket extends EventTarget {
+    #url;
     #secret;
+    #requestPIN;
+    #pinError;
+    #pake;
+    #certificate;
+    #certificateRejected;
+    #challenge;
+    #device;
     #authenticated;
+    #ready;
+    #features;
+    #scopes;
+    #closeReason;
+    #retry;
+    #pingTimeout;
+    #watchdogTimeout;
+    #session;
+    #resumeTimeout;
+    #resumeDeadline;
+    #pendingMessages;
+    #encryption;
+    #cipher;
     #ws;
 
-    constructor(url, secret) {
+    // requestPIN is called without secret and paired device and returns a
+    // promise for the PIN shown in the terminal
+    constructor(url, secret, requestPIN) {
         super();
+        this.#url = url;
         this.#secret = secret;
+        this.#requestPIN = requestPIN;
+        this.#pinError = "";
+        this.#certificateRejected = false;
+        this.#device = loadDevice();
+        this.#features = [];
+        this.#scopes = [];
+        this.#pingTimeout = 0;
+        this.#watchdogTimeout = null;
+        this.#session = "";
+        this.#resumeTimeout = 0;
+        this.#resumeDeadline = 0;
+        this.#pendingMessages = [];
+        this.#retry = false;
+        // TLS already protects the connection
+        this.#encryption = location.protocol != "https:";
+    }
+
+    connect() {
+        this.#connect();
+    }
+
+    get features() {
+        return this.#features;
+    }
+
+    get scopes() {
+        return this.#scopes;
+    }
+
+    // Certificates are managed centrally and must not be replaced by device
+    // tokens
+    get pairingAvailable() {
+        return !this.#device && !this.#certificate && this.#features.includes("pairing") &&
+            this.#scopes.includes("pairing");
+    }
+
+    pair() {
+        this.send({type: "pair", name: navigator.userAgent.substring(0, MAX_DEVICE_NAME)});
+    }
+
+    async #connect() {
         this.#authenticated = false;
-        this.#ws = new WebSocket(url);
+        this.#ready = false;
+        this.#closeReason = "";
+        this.#cipher = null;
+        this.#pake = null;
+        this.#certificate = false;
+        if (!this.#device && !this.#secret) {
+            if (location.protocol == "https:" && !this.#certificateRejected) {
+                // The browser sends the client certificate, if there is one
+                this.#certificate = true;
+            } else {
+                this.#pake = new PAKE(await this.#requestPIN(this.#pinError));
+                this.#pinError = "";
+            }
+        }
+        this.#ws = new WebSocket(this.#url);
         this.#ws.addEventListener("message", this.#handle_ws_message.bind(this));
         this.#ws.addEventListener("close", this.#handle_ws_close.bind(this));
     }
 
+    #resetWatchdog() {
+        if (this.#watchdogTimeout != null) {
+            clearTimeout(this.#watchdogTimeout);
+            this.#watchdogTimeout = null;
+        }
+        if (this.#pingTimeout > 0) {
+            this.#watchdogTimeout = setTimeout(() => this.#ws.close(), this.#pingTimeout);
+        }
+    }
+
     #handle_ws_message(event) {
+        this.#resetWatchdog();
         if (!this.#authenticated) {
-            this.#ws.send(challengeResponse(event.data, this.#secret));
+            this.#challenge = event.data;
+            const hello = {
+                type: "hello",
+                versions: PROTOCOL_VERSIONS,
+                features: this.#encryption || this.#pake ? [...PROTOCOL_FEATURES, "encryption"] : PROTOCOL_FEATURES,
+            };
+            const secret = this.#device ? this.#device.token : this.#secret;
+            if (this.#pake) {
+                // The connection is encrypted with the exchanged key
+                hello.auth = AUTH_SCHEME_PIN;
+                hello.pake = this.#pake.element;
+            } else if (this.#certificate) {
+                hello.auth = AUTH_SCHEME_CERTIFICATE;
+            } else {
+                hello.auth = AUTH_SCHEME;
+                hello.response = challengeResponse(event.data, secret, hello.features.includes("encryption"));
+            }
+            if (this.#device) {
+                hello.device = this.#device.id;
+            }
+            if (this.#session) {
+                hello.resume = this.#session;
+            }
+            this.#ws.send(JSON.stringify(hello));
             this.#authenticated = true;
+            if (this.#encryption && !this.#pake) {
+                // Only used if the server accepts the feature
+                this.#cipher = new MessageCipher(secret, event.data);
+            }
             return;
         }
-        let config;
+        let message;
         try {
-            config = JSON.parse(event.data);
+            // The hello of the server is never encrypted
+            message = JSON.parse(this.#ready && this.#cipher ? this.#cipher.open(event.data) : event.data);
         } catch (e) {
             this.#ws.close();
             throw (e);
         }
-        this.dispatchEvent(new CustomEvent("config", {detail: config}));
+        if (message.type == "pake" && this.#pake) {
+            let keys;
+            try {
+                keys = this.#pake.finish(this.#challenge, message.element);
+            } catch (e) {
+                this.#ws.close();
+                throw (e);
+            }
+            this.#ws.send(JSON.stringify({type: "pake", confirmation: keys.confirmation}));
+            this.#cipher = new MessageCipher(keys.secret, this.#challenge);
+        } else if (message.type == "hello") {
+            if (!PROTOCOL_VERSIONS.includes(message.version)) {
+                this.#ws.close();
+                throw new Error("unsupported protocol version");
+            }
+            this.#features = message.features;
+            this.#scopes = message.scopes || [];
+            if (this.#cipher && !this.#features.includes("encryption")) {
+                this.#closeReason = "Server doesn't support encryption";
+                this.#ws.close();
+                return;
+            }
+            this.#pingTimeout = message.pingTimeout || 0;
+            this.#resetWatchdog();
+            this.#session = message.session || "";
+            this.#resumeTimeout = message.resumeTimeout || 0;
+            this.#resumeDeadline = 0;
+            this.#ready = true;
+            for (const data of this.#pendingMessages) {
+                this.#wsSend(data);
+            }
+            this.#pendingMessages = [];
+            // Entering the PIN already asks to pair, other clients pair
+            // on request of the user
+            if (this.#pake && this.pairingAvailable) {
+                this.pair();
+            }
+        } else if (message.type == "paired") {
+            this.#device = {id: message.device, token: message.token};
+            storeDevice(this.#device);
+            this.dispatchEvent(new CustomEvent("paired"));
+        } else if (message.type == "ping") {
+            this.send({type: "pong", time: message.time});
+        } else if (message.type == "rate") {
+            this.dispatchEvent(new CustomEvent("rate", {detail: message.updateRate}));
+        } else if (message.type == "stats") {
+            this.dispatchEvent(new CustomEvent("stats", {detail: message}));
+        } else if (message.type == "config") {
+            this.dispatchEvent(new CustomEvent("config", {detail: message}));
+        } else if (message.type == "error") {
+            if (message.fatal && message.code == "unauthorized" && this.#device) {
+                // The device was revoked, authenticate with the secret or a
+                // PIN instead
+                this.#device = null;
+                storeDevice(null);
+                this.#retry = true;
+            } else if (message.fatal && message.code == "unauthorized" && this.#certificate) {
+                this.#certificateRejected = true;
+                this.#retry = true;
+            } else if (message.fatal && message.code == "unauthorized" && this.#pake) {
+                this.#pinError = message.message;
+                this.#retry = true;
+            } else if (message.fatal) {
+                this.#closeReason = message.message;
+            } else {
+                this.dispatchEvent(new CustomEvent("error", {detail: message}));
+            }
+        }
     }
 
     #handle_ws_close() {
-        this.dispatchEvent(new CustomEvent("close"));
+        this.#ready = false;
+        this.#pingTimeout = 0;
+        this.#resetWatchdog();
+        if (this.#retry) {
+            this.#retry = false;
+            this.#connect();
+            return;
+        }
+        if (!this.#closeReason && this.#session && this.#resumeTimeout > 0) {
+            if (this.#resumeDeadline == 0) {
+                this.#resumeDeadline = Date.now() + this.#resumeTimeout;
+            }
+            if (Date.now() < this.#resumeDeadline) {
+                this.dispatchEvent(new CustomEvent("reconnecting"));
+                setTimeout(this.#connect.bind(this), RECONNECT_DELAY);
+                return;
+            }
+        }
+        this.#pendingMessages = [];
+        this.dispatchEvent(new CustomEvent("close", {detail: this.#closeReason}));
+    }
+
+    #wsSend(data) {
+        this.#ws.send(this.#cipher ? this.#cipher.seal(data) : data);
     }
 
     send(message) {
-        this.#ws.send(message);
+        const data = JSON.stringify(message);
+        if (this.#ready) {
+            this.#wsSend(data);
+        } else if (this.#session && this.#pendingMessages.length < MAX_PENDING_MESSAGES) {
+            // Delivered after the session is resumed
+            this.#pendingMessages.push(data);
+        }
     }
 }
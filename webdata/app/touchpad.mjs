@@ -19,18 +19,6 @@
 
 import {POINTER_BUTTON_LEFT, POINTER_BUTTON_MIDDLE, POINTER_BUTTON_RIGHT} from "./inputcontroller.mjs";
 
-// [1 Touch, 2 Touches, 3 Touches] (as pixel)
-const TOUCH_MOVE_THRESHOLD = [10, 15, 15];
-// Max time between consecutive touches for clicking or dragging (as milliseconds)
-const TOUCH_TIMEOUT = 250;
-// [[pixel/second, multiplicator], ...]
-const POINTER_ACCELERATION = [
-    [0, 0],
-    [87, 1],
-    [173, 1],
-    [553, 2],
-];
-
 const copyTouch = (touch, timeStamp) => ({
     identifier: touch.identifier,
     pageX: touch.pageX,
@@ -40,22 +28,23 @@ const copyTouch = (touch, timeStamp) => ({
     timeStamp: timeStamp,
 });
 
-const calculateAccelerationMult = (speed) => {
-    for (let i = 0; i < POINTER_ACCELERATION.length; i += 1) {
-        const s2 = POINTER_ACCELERATION[i][0];
-        const a2 = POINTER_ACCELERATION[i][1];
+// acceleration: [[pixel/second, multiplicator], ...]
+const calculateAccelerationMult = (acceleration, speed) => {
+    for (let i = 0; i < acceleration.length; i += 1) {
+        const s2 = acceleration[i][0];
+        const a2 = acceleration[i][1];
         if (s2 <= speed) {
             continue;
         }
         if (i == 0) {
             return a2;
         }
-        const s1 = POINTER_ACCELERATION[i - 1][0];
-        const a1 = POINTER_ACCELERATION[i - 1][1];
+        const s1 = acceleration[i - 1][0];
+        const a1 = acceleration[i - 1][1];
         return ((speed - s1) / (s2 - s1)) * (a2 - a1) + a1;
     }
-    if (POINTER_ACCELERATION.length > 0) {
-        return POINTER_ACCELERATION[POINTER_ACCELERATION.length - 1][1];
+    if (acceleration.length > 0) {
+        return acceleration[acceleration.length - 1][1];
     }
     return 1;
 };
@@ -63,6 +52,12 @@ const calculateAccelerationMult = (speed) => {
 export default class Touchpad {
     #moveSpeed = 1;
     #scrollSpeed = 1;
+    #acceleration = [];
+    // [1 Touch, 2 Touches, 3 Touches] (as pixel)
+    #touchMoveThreshold = [10, 15, 15];
+    // Max time between consecutive touches for clicking or dragging (as milliseconds)
+    #touchTimeout = 250;
+    #tapToDrag = true;
 
     #moved = false;
     #startTimeStamp = 0;
@@ -86,6 +81,10 @@ export default class Touchpad {
     configure(config) {
         this.#moveSpeed = config.moveSpeed;
         this.#scrollSpeed = config.scrollSpeed;
+        this.#acceleration = config.acceleration.points;
+        this.#touchMoveThreshold = config.touchMoveThreshold;
+        this.#touchTimeout = config.touchTimeout;
+        this.#tapToDrag = config.tapToDrag;
     }
 
     #ongoingTouchIndexById(idToFind) {
@@ -155,7 +154,7 @@ export default class Touchpad {
         event.preventDefault();
         this.#lastEndTimeStamp = event.timeStamp;
         this.#inputController.pointerScroll(0, 0, true);
-        if (this.#releasedCount > TOUCH_MOVE_THRESHOLD.length) {
+        if (this.#releasedCount > this.#touchMoveThreshold.length) {
             this.#moved = true;
         }
         if (this.#ongoingTouches.length == 0 && this.#releasedCount >= 1) {
@@ -163,7 +162,7 @@ export default class Touchpad {
                 this.#dragging = false;
                 this.#inputController.pointerButton(POINTER_BUTTON_LEFT, false);
             }
-            if (!this.#moved && event.timeStamp - this.#startTimeStamp < TOUCH_TIMEOUT) {
+            if (!this.#moved && event.timeStamp - this.#startTimeStamp < this.#touchTimeout) {
                 let button = 0;
                 if (this.#releasedCount == 1) {
                     button = POINTER_BUTTON_LEFT;
@@ -173,9 +172,9 @@ export default class Touchpad {
                     button = POINTER_BUTTON_MIDDLE;
                 }
                 this.#inputController.pointerButton(button, true);
-                if (button == POINTER_BUTTON_LEFT) {
+                if (button == POINTER_BUTTON_LEFT && this.#tapToDrag) {
                     this.#draggingTimeout = setTimeout(
-                        this.#handleDraggingTimeout.bind(this), TOUCH_TIMEOUT);
+                        this.#handleDraggingTimeout.bind(this), this.#touchTimeout);
                 } else {
                     this.#inputController.pointerButton(button, false);
                 }
@@ -200,17 +199,17 @@ export default class Touchpad {
                     Math.pow(touches[i].pageX - this.#ongoingTouches[idx].pageXStart, 2) +
                     Math.pow(touches[i].pageY - this.#ongoingTouches[idx].pageYStart, 2)
                 );
-                if (this.#ongoingTouches.length > TOUCH_MOVE_THRESHOLD.length ||
-                    dist > TOUCH_MOVE_THRESHOLD[this.#ongoingTouches.length - 1] ||
-                    event.timeStamp - this.#startTimeStamp >= TOUCH_TIMEOUT) {
+                if (this.#ongoingTouches.length > this.#touchMoveThreshold.length ||
+                    dist > this.#touchMoveThreshold[this.#ongoingTouches.length - 1] ||
+                    event.timeStamp - this.#startTimeStamp >= this.#touchTimeout) {
                     this.#moved = true;
                 }
             }
             const dx = touches[i].pageX - this.#ongoingTouches[idx].pageX;
             const dy = touches[i].pageY - this.#ongoingTouches[idx].pageY;
             const timeDelta = event.timeStamp - this.#ongoingTouches[idx].timeStamp;
-            sumX += dx * calculateAccelerationMult(Math.abs(dx) / timeDelta * 1000);
-            sumY += dy * calculateAccelerationMult(Math.abs(dy) / timeDelta * 1000);
+            sumX += dx * calculateAccelerationMult(this.#acceleration, Math.abs(dx) / timeDelta * 1000);
+            sumY += dy * calculateAccelerationMult(this.#acceleration, Math.abs(dy) / timeDelta * 1000);
             this.#ongoingTouches[idx].pageX = touches[i].pageX;
             this.#ongoingTouches[idx].pageY = touches[i].pageY;
             this.#ongoingTouches[idx].timeStamp = event.timeStamp;
@@ -219,13 +218,14 @@ export default class Touchpad {
             return;
         }
         event.preventDefault();
-        if (this.#moved && event.timeStamp - this.#lastEndTimeStamp >= TOUCH_TIMEOUT) {
+        if (this.#moved && event.timeStamp - this.#lastEndTimeStamp >= this.#touchTimeout) {
             if (this.#ongoingTouches.length == 1 || this.#dragging) {
                 this.#inputController.pointerMove(
                     sumX * this.#moveSpeed, sumY * this.#moveSpeed);
             } else if (this.#ongoingTouches.length == 2) {
+                // The server applies the scroll direction
                 this.#inputController.pointerScroll(
-                    -sumX * this.#scrollSpeed, -sumY * this.#scrollSpeed, false);
+                    sumX * this.#scrollSpeed, sumY * this.#scrollSpeed, false, false);
             }
         }
     }
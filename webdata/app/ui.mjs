@@ -24,11 +24,17 @@ import * as compat from "./compat.mjs";
 
 const IGNORE_CLICK_AFTER_TOUCH_DURATION = 1000; // milliseconds
 const CLICK_VIBRATION_PATTERN = [10];
+const TOAST_DURATION = 3000; // milliseconds
 
 const buttons = document.querySelectorAll("button");
 const scenes = document.querySelectorAll("body > .scene");
 const openingScene = document.getElementById("opening");
 const closedScene = document.getElementById("closed");
+const closedReason = closedScene.querySelector(".reason");
+const pinScene = document.getElementById("pin");
+const pinReason = pinScene.querySelector(".reason");
+const pinInput = pinScene.querySelector("input");
+const sendPIN = document.getElementById("send-pin");
 const padScene = document.getElementById("pad");
 const keysScene = document.getElementById("keys");
 const keysPages = keysScene.querySelectorAll(":scope > .page");
@@ -36,6 +42,15 @@ const textInputScene = document.getElementById("text-input");
 const textInput = textInputScene.querySelector("textarea");
 const mouseScene = document.getElementById("mouse");
 const sendText = document.getElementById("send-text");
+const toast = document.getElementById("toast");
+const fingerprint = padScene.querySelector(".fingerprint");
+const stats = padScene.querySelector(".stats");
+const settingsButton = padScene.querySelector(".settings-button");
+const settingsScene = document.getElementById("settings");
+const settingsForm = settingsScene.querySelector("form");
+const settingsInputs = settingsForm.querySelectorAll("input, select");
+const resetSettingsButton = settingsScene.querySelector(".reset-button");
+const pairing = settingsScene.querySelector(".pairing");
 
 export default class UI {
     #activeScene = null;
@@ -43,6 +58,8 @@ export default class UI {
     #ready = false;
     #closed = false;
     #ignoreClickUntilTimeStamp = Number.MIN_VALUE;
+    #toastTimeout = null;
+    #resolvePIN = null;
     #inputController;
     #mouse;
     #keyboard;
@@ -59,6 +76,15 @@ export default class UI {
         document.addEventListener("touchend", this.#handleTouchend.bind(this));
         textInput.addEventListener("input", () => { this.#updateTextInput(); });
         sendText.addEventListener("click", this.#handleSendText.bind(this));
+        sendPIN.addEventListener("click", this.#handleSendPIN.bind(this));
+        for (const input of settingsInputs) {
+            input.addEventListener("change", () => { this.#handleSettingChange(input); });
+        }
+        pinInput.addEventListener("keydown", (event) => {
+            if (event.key == "Enter") {
+                this.#handleSendPIN();
+            }
+        });
         window.addEventListener("popstate", () => { this.#update(); });
         compat.addFullscreenchangeEventListener(() => { this.#update(); });
         compat.addPointerlockchangeEventListener(() => { this.#update(); });
@@ -70,6 +96,14 @@ export default class UI {
     }
 
    configure(config) {
+        for (const input of settingsInputs) {
+            if (input.type == "checkbox") {
+                input.checked = config[input.name];
+            } else {
+                input.value = input.name == "acceleration" ? config.acceleration.profile : config[input.name];
+            }
+        }
+        this.#updateSettingsScene();
         this.#mouse.configure(config);
         this.#keyboard.configure(config);
         this.#touchpad.configure(config);
@@ -79,12 +113,65 @@ export default class UI {
         this.#update();
     }
 
-    close() {
+    close(reason = "") {
+        closedReason.textContent = reason;
+        closedReason.classList.toggle("hidden", !reason);
         this.#ready = false;
         this.#closed = true;
         this.#update();
     }
 
+    // Asks for the PIN shown in the terminal. Returns a promise for the PIN.
+    requestPIN(reason = "") {
+        pinReason.textContent = reason;
+        pinReason.classList.toggle("hidden", !reason);
+        pinInput.value = "";
+        return new Promise((resolve) => {
+            this.#resolvePIN = resolve;
+            this.#update();
+            pinInput.focus();
+        });
+    }
+
+    #handleSendPIN() {
+        const pin = pinInput.value.trim();
+        if (pin && this.#resolvePIN) {
+            const resolve = this.#resolvePIN;
+            this.#resolvePIN = null;
+            this.#update();
+            resolve(pin);
+        }
+    }
+
+    // Displays the certificate fingerprint from the URL for comparison with
+    // the certificate shown by the browser
+    showFingerprint(value) {
+        const bytes = atob(value.replace(/-/g, "+").replace(/_/g, "/"));
+        const hex = Array.from(bytes, (c) => c.charCodeAt(0).toString(16).padStart(2, "0"));
+        fingerprint.textContent = "SHA-256: " + hex.join(":").toUpperCase();
+        fingerprint.classList.remove("hidden");
+    }
+
+    // Displays the latency measured by the server, to tell a slow network
+    // apart from a slow controller
+    showStats(value) {
+        stats.textContent = `RTT ${value.roundTripTime.toFixed(1)} ms · ` +
+            `Controller ${value.controllerTime.toFixed(1)} ms`;
+        stats.classList.remove("hidden");
+    }
+
+    showToast(message) {
+        toast.textContent = message;
+        toast.classList.remove("hidden");
+        if (this.#toastTimeout != null) {
+            clearTimeout(this.#toastTimeout);
+        }
+        this.#toastTimeout = setTimeout(() => {
+            this.#toastTimeout = null;
+            toast.classList.add("hidden");
+        }, TOAST_DURATION);
+    }
+
     #handleTouchend(event) {
         // HACK: event.preventDefault doesn't reliably stop click events in Firefox (112)
         this.#ignoreClickUntilTimeStamp = event.timeStamp + IGNORE_CLICK_AFTER_TOUCH_DURATION;
@@ -107,6 +194,55 @@ export default class UI {
         textInput.focus();
     }
 
+    #handleSettingChange(input) {
+        if (input.name == "acceleration") {
+            this.#inputController.changeSettings({acceleration: input.value});
+            return;
+        }
+        if (input.type == "checkbox") {
+            this.#inputController.changeSettings({[input.name]: input.checked});
+            return;
+        }
+        const value = Number(input.value);
+        if (input.checkValidity() && input.value && value > 0) {
+            this.#inputController.changeSettings({[input.name]: value});
+        }
+    }
+
+    resetSettings() {
+        this.#inputController.changeSettings({}, true);
+    }
+
+    pair() {
+        this.#inputController.pair();
+    }
+
+    paired() {
+        this.showToast("Device paired");
+        this.#updateSettingsScene();
+        this.#update();
+    }
+
+    // The settings scene also offers pairing
+    get #settingsSceneAllowed() {
+        return this.#inputController.settingsAllowed || this.#inputController.pairingAvailable;
+    }
+
+    #updateSettingsScene() {
+        const settingsAllowed = this.#inputController.settingsAllowed;
+        settingsButton.classList.toggle("hidden", !this.#settingsSceneAllowed);
+        settingsForm.classList.toggle("hidden", !settingsAllowed);
+        resetSettingsButton.classList.toggle("hidden", !settingsAllowed);
+        pairing.classList.toggle("hidden", !this.#inputController.pairingAvailable);
+    }
+
+    showSettings() {
+        this.#showScene(settingsScene);
+        if (history.state != "settings") {
+            history.pushState("settings", "");
+        }
+    }
+
     #handleButtonClick(event) {
         event.target.classList.add("click");
         setTimeout(() => event.target.classList.remove("click"), 0);
@@ -184,7 +320,9 @@ export default class UI {
         for (const element of document.querySelectorAll(".visble-if-fullscreen-enabled")) {
             element.classList.toggle("hidden", !fullscreenEnabled);
         }
-        if (!this.#ready) {
+        if (this.#resolvePIN) {
+            this.#showScene(pinScene);
+        } else if (!this.#ready) {
             this.#showScene(this.#closed ? closedScene : openingScene);
         } else if (compat.pointerLockElement()) {
             this.#showScene(mouseScene);
@@ -192,6 +330,8 @@ export default class UI {
             this.showKeys(history.state.substr("keys:".length));
         } else if (history.state == "text-input") {
             this.showTextInput();
+        } else if (history.state == "settings" && this.#settingsSceneAllowed) {
+            this.showSettings();
         } else {
             this.#showScene(padScene);
         }